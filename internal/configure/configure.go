@@ -23,6 +23,7 @@
 package configure
 
 import (
+	"fmt"
 	"path"
 	"path/filepath"
 	"time"
@@ -48,7 +49,17 @@ type Context struct {
  *   proxy_connect_timeout: 3
  *   proxy_send_timeout: 60
  *   proxy_read_timeout: 60
+ *   proxy_next_upstream: [error, timeout, http_502]
  *   proxy_next_upstream_tries: 0
+ *   client_body_buffer_size: 1048576
+ *   proxy_buffering: on
+ *   flush_interval: 100ms
+ *   proxy_x_forwarded_for: append
+ *   proxy_forwarded: off
+ *   proxy_set_host: $host
+ *   proxy_redirect: [default, "http://backend.internal/ $scheme://$host/"]
+ *   proxy_cookie_domain: ["backend.internal example.com"]
+ *   proxy_cookie_path: ["/app/ /"]
  *   config:
  *     enable: true
  *
@@ -57,19 +68,58 @@ type Context struct {
  *     listen: 127.0.0.1:8000
  *   - name: server2
  *     listen: 127.0.0.1:8001
+ *     enable_tls: true
+ *     enable_http3: true
+ *     certificates:
+ *       - name: "*.example.com"
+ *         cert_file: cert/example.com.crt
+ *         key_file: cert/example.com.key
+ *     http2: on
+ *     h2c: off
+ *     http2_max_concurrent_streams: 128
+ *     http2_max_read_frame_size: 1048576
+ *     http2_idle_timeout: 3m
  *     config:
  *       enable: false
  *
  * upstreams:
  *   - name: upstream1
+ *     balance: hash $request_uri consistent
+ *     sticky: cookie srv_id expires=1h path=/
+ *     keepalive: 32
+ *     keepalive_timeout: 60s
+ *     keepalive_requests: 1000
+ *     max_conns: 0
+ *     scheme: https
+ *     proxy_ssl_trusted_ca: cert/ca.crt
+ *     proxy_ssl_certificate: cert/client.crt
+ *     proxy_ssl_certificate_key: cert/client.key
+ *     proxy_ssl_server_name: backend.internal
+ *     proxy_ssl_verify: on
+ *     proxy_ssl_min_version: TLSv1.2
+ *     mirror: upstream2
+ *     hedge_delay: 50ms
+ *     retry_budget: 20%
+ *     retry_budget_min: 10
+ *     retry_budget_window: 10s
+ *     resolve: 30s
+ *     resolver: 127.0.0.1:53
  *     check_interval: 1
+ *     check_timeout: 500ms
+ *     rise: 2
+ *     fall: 3
+ *     check_type: http
+ *     check_http_path: /health
+ *     check_http_status: [200, 3xx]
  *     servers:
- *        - 127.0.0.1:9000
+ *        - 127.0.0.1:9000 weight=3 max_fails=2 fail_timeout=10s slow_start=30s
  *        - 127.0.0.1:9001
+ *        - 127.0.0.1:9002 backup
  *   - name: upstream2
  *     servers:
  *        - 127.0.0.1:9000
  *        - 127.0.0.1:9001
+ *        - unix:/run/app.sock
  */
 type (
 	Global struct {
@@ -85,10 +135,20 @@ type (
 		MultipartMaxMemory int64  `mapstructure:"multipart_max_memory" default:"1048576"`
 		MultipartTempPath  string `mapstructure:"multipart_temp_path" default:"/tmp"`
 
-		ProxyConnectTimeout    int `mapstructure:"proxy_connect_timeout" default:"3"`
-		ProxySendTimeout       int `mapstructure:"proxy_send_timeout" default:"60"`
-		ProxyReadTimeout       int `mapstructure:"proxy_read_timeout" default:"60"`
-		ProxyNextUpstreamTries int `mapstructure:"proxy_next_upstream_tries" default:"0"`
+		ProxyConnectTimeout    int      `mapstructure:"proxy_connect_timeout" default:"3"`
+		ProxySendTimeout       int      `mapstructure:"proxy_send_timeout" default:"60"`
+		ProxyReadTimeout       int      `mapstructure:"proxy_read_timeout" default:"60"`
+		ProxyNextUpstream      []string `mapstructure:"proxy_next_upstream" default:"[error,timeout]"`
+		ProxyNextUpstreamTries int      `mapstructure:"proxy_next_upstream_tries" default:"0"`
+		ClientBodyBufferSize   int64    `mapstructure:"client_body_buffer_size" default:"1048576"`
+		ProxyBuffering         string   `mapstructure:"proxy_buffering" default:"on"`
+		FlushInterval          string   `mapstructure:"flush_interval" default:"0"`
+		ProxyXForwardedFor     string   `mapstructure:"proxy_x_forwarded_for" default:"append"`
+		ProxyForwarded         string   `mapstructure:"proxy_forwarded" default:"off"`
+		ProxySetHost           string   `mapstructure:"proxy_set_host"`
+		ProxyRedirect          []string `mapstructure:"proxy_redirect" default:"[default]"`
+		ProxyCookieDomain      []string `mapstructure:"proxy_cookie_domain"`
+		ProxyCookiePath        []string `mapstructure:"proxy_cookie_path"`
 
 		Config map[string]interface{} `mapstructure:"config"`
 	}
@@ -107,24 +167,91 @@ type (
 		MultipartMaxMemory int64  `mapstructure:"multipart_max_memory" default:"1048576"`
 		MultipartTempPath  string `mapstructure:"multipart_temp_path" default:"/tmp"`
 
-		ProxyConnectTimeout    int `mapstructure:"proxy_connect_timeout" default:"3"`
-		ProxySendTimeout       int `mapstructure:"proxy_send_timeout" default:"60"`
-		ProxyReadTimeout       int `mapstructure:"proxy_read_timeout" default:"60"`
-		ProxyNextUpstreamTries int `mapstructure:"proxy_next_upstream_tries" default:"0"`
+		ProxyConnectTimeout    int      `mapstructure:"proxy_connect_timeout" default:"3"`
+		ProxySendTimeout       int      `mapstructure:"proxy_send_timeout" default:"60"`
+		ProxyReadTimeout       int      `mapstructure:"proxy_read_timeout" default:"60"`
+		ProxyNextUpstream      []string `mapstructure:"proxy_next_upstream" default:"[error,timeout]"`
+		ProxyNextUpstreamTries int      `mapstructure:"proxy_next_upstream_tries" default:"0"`
+		ClientBodyBufferSize   int64    `mapstructure:"client_body_buffer_size" default:"1048576"`
+		ProxyBuffering         string   `mapstructure:"proxy_buffering" default:"on"`
+		FlushInterval          string   `mapstructure:"flush_interval" default:"0"`
+		ProxyXForwardedFor     string   `mapstructure:"proxy_x_forwarded_for" default:"append"`
+		ProxyForwarded         string   `mapstructure:"proxy_forwarded" default:"off"`
+		ProxySetHost           string   `mapstructure:"proxy_set_host"`
+		ProxyRedirect          []string `mapstructure:"proxy_redirect" default:"[default]"`
+		ProxyCookieDomain      []string `mapstructure:"proxy_cookie_domain"`
+		ProxyCookiePath        []string `mapstructure:"proxy_cookie_path"`
 
 		PProfEnable bool   `mapstructure:"pprof_enable" default:"false"`
 		PProfPrefix string `mapstructure:"pprof_prefix" default:"/debug/pprof"`
 
 		EnableTLS   bool   `mapstructure:"enable_tls" default:"false"`
+		EnableHTTP3 bool   `mapstructure:"enable_http3" default:"false"`
 		TLSCertFile string `mapstructure:"tls_cert_file" default:"cert/server.crt"`
 		TLSKeyFile  string `mapstructure:"tls_key_file" default:"cert/server.key"`
 
+		Certificates []Certificate `mapstructure:"certificates"`
+
+		HTTP2                     string `mapstructure:"http2" default:"on"`
+		H2C                       string `mapstructure:"h2c" default:"off"`
+		HTTP2MaxConcurrentStreams int    `mapstructure:"http2_max_concurrent_streams" default:"128"`
+		HTTP2MaxReadFrameSize     int    `mapstructure:"http2_max_read_frame_size" default:"1048576"`
+		HTTP2IdleTimeout          string `mapstructure:"http2_idle_timeout" default:"0"`
+
 		Config map[string]interface{} `mapstructure:"config"`
+
+		flushInterval    time.Duration
+		http2IdleTimeout time.Duration
 	}
 
 	Upstream struct {
 		Name    string   `mapstructure:"name"`
 		Servers []string `mapstructure:"servers"`
+		Balance string   `mapstructure:"balance" default:"round_robin"`
+		Mirror  string   `mapstructure:"mirror"`
+		Sticky  string   `mapstructure:"sticky"`
+
+		HedgeDelay        string `mapstructure:"hedge_delay" default:"0"`
+		RetryBudget       string `mapstructure:"retry_budget" default:"off"`
+		RetryBudgetMin    int    `mapstructure:"retry_budget_min" default:"10"`
+		RetryBudgetWindow string `mapstructure:"retry_budget_window" default:"10s"`
+
+		Resolve  string `mapstructure:"resolve" default:"0"`
+		Resolver string `mapstructure:"resolver"`
+
+		Keepalive         string `mapstructure:"keepalive" default:"32"`
+		KeepaliveTimeout  string `mapstructure:"keepalive_timeout" default:"60s"`
+		KeepaliveRequests int    `mapstructure:"keepalive_requests" default:"1000"`
+		MaxConns          int    `mapstructure:"max_conns" default:"0"`
+
+		Scheme                 string `mapstructure:"scheme"`
+		ProxySSLTrustedCA      string `mapstructure:"proxy_ssl_trusted_ca"`
+		ProxySSLCertificate    string `mapstructure:"proxy_ssl_certificate"`
+		ProxySSLCertificateKey string `mapstructure:"proxy_ssl_certificate_key"`
+		ProxySSLServerName     string `mapstructure:"proxy_ssl_server_name"`
+		ProxySSLVerify         string `mapstructure:"proxy_ssl_verify" default:"on"`
+		ProxySSLMinVersion     string `mapstructure:"proxy_ssl_min_version" default:"TLSv1.2"`
+
+		CheckInterval   string   `mapstructure:"check_interval" default:"0"`
+		CheckTimeout    string   `mapstructure:"check_timeout" default:"1s"`
+		CheckRise       int      `mapstructure:"rise" default:"2"`
+		CheckFall       int      `mapstructure:"fall" default:"3"`
+		CheckType       string   `mapstructure:"check_type" default:"tcp"`
+		CheckHTTPPath   string   `mapstructure:"check_http_path" default:"/"`
+		CheckHTTPStatus []string `mapstructure:"check_http_status" default:"[2xx,3xx]"`
+
+		peers             []Peer
+		balance           Balance
+		sticky            *Sticky
+		hedgeDelay        time.Duration
+		retryBudget       int
+		retryBudgetWindow time.Duration
+		keepalive         int
+		keepaliveTimeout  time.Duration
+		sslMinVersion     uint16
+		resolveInterval   time.Duration
+		checkInterval     time.Duration
+		checkTimeout      time.Duration
 	}
 
 	Configure struct {
@@ -165,6 +292,29 @@ func Parse(filename string, ctx Context) (*Configure, error) {
 		cfg.merge(server)
 		server.context = ctx
 		defaults.SetDefaults(server)
+		err = server.parse()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	names := map[string]bool{}
+	for i := range cfg.Upstreams {
+		upstream := &cfg.Upstreams[i]
+		defaults.SetDefaults(upstream)
+		err = upstream.parse()
+		if err != nil {
+			return nil, err
+		} else if names[upstream.Name] {
+			return nil, fmt.Errorf("duplicate upstream %s", upstream.Name)
+		}
+		names[upstream.Name] = true
+	}
+	for _, upstream := range cfg.Upstreams {
+		mirror := upstream.GetMirror()
+		if len(mirror) > 0 && (!names[mirror] || mirror == upstream.Name) {
+			return nil, fmt.Errorf("upstream %s: invalid mirror '%s'", upstream.Name, mirror)
+		}
 	}
 	return cfg, nil
 }
@@ -205,9 +355,39 @@ func (cfg *Configure) merge(server *Server) {
 	if server.ProxyReadTimeout == 0 {
 		server.ProxyReadTimeout = global.ProxyReadTimeout
 	}
+	if len(server.ProxyNextUpstream) == 0 {
+		server.ProxyNextUpstream = global.ProxyNextUpstream
+	}
 	if server.ProxyNextUpstreamTries == 0 {
 		server.ProxyNextUpstreamTries = global.ProxyNextUpstreamTries
 	}
+	if server.ClientBodyBufferSize == 0 {
+		server.ClientBodyBufferSize = global.ClientBodyBufferSize
+	}
+	if len(server.ProxyBuffering) == 0 {
+		server.ProxyBuffering = global.ProxyBuffering
+	}
+	if len(server.FlushInterval) == 0 {
+		server.FlushInterval = global.FlushInterval
+	}
+	if len(server.ProxyXForwardedFor) == 0 {
+		server.ProxyXForwardedFor = global.ProxyXForwardedFor
+	}
+	if len(server.ProxyForwarded) == 0 {
+		server.ProxyForwarded = global.ProxyForwarded
+	}
+	if len(server.ProxySetHost) == 0 {
+		server.ProxySetHost = global.ProxySetHost
+	}
+	if len(server.ProxyRedirect) == 0 {
+		server.ProxyRedirect = global.ProxyRedirect
+	}
+	if len(server.ProxyCookieDomain) == 0 {
+		server.ProxyCookieDomain = global.ProxyCookieDomain
+	}
+	if len(server.ProxyCookiePath) == 0 {
+		server.ProxyCookiePath = global.ProxyCookiePath
+	}
 
 	gconfig := newIfNil(global.Config)
 	sconfig := newIfNil(server.Config)
@@ -258,6 +438,6 @@ func (cfg *Configure) GetServer(name string) *ServerConfigure {
 	return nil
 }
 
-func (cfg *Configure) GetUpstreams() []Upstream {
+func (cfg *Configure) GetUpstreams() []UpstreamConfigure {
 	return cfg.Upstreams
 }
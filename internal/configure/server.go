@@ -23,17 +23,51 @@
 package configure
 
 import (
+	"fmt"
 	"path"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
+const (
+	SWITCH_ON  = "on"
+	SWITCH_OFF = "off"
+
+	X_FORWARDED_FOR_APPEND    = "append"
+	X_FORWARDED_FOR_OVERWRITE = "overwrite"
+	X_FORWARDED_FOR_OFF       = "off"
+
+	PROXY_REDIRECT_DEFAULT = "default"
+)
+
+var (
+	PROXY_NEXT_UPSTREAM_CONDITIONS = map[string]bool{
+		"error":          true,
+		"timeout":        true,
+		"http_500":       true,
+		"http_502":       true,
+		"http_503":       true,
+		"http_504":       true,
+		"non_idempotent": true,
+		"off":            true,
+	}
+)
+
 type (
 	ServerConfigure = Server
 
 	ModuleConfig struct {
 		m map[string]interface{}
 	}
+
+	// Certificate is selected by SNI, the name is either an exact
+	// server name or a wildcard like *.example.com.
+	Certificate struct {
+		Name     string `mapstructure:"name"`
+		CertFile string `mapstructure:"cert_file"`
+		KeyFile  string `mapstructure:"key_file"`
+	}
 )
 
 func (cfg *ServerConfigure) absPath(filename string) string {
@@ -53,14 +87,146 @@ func (cfg *ServerConfigure) GetLogLevel() string            { return cfg.LogLeve
 func (cfg *ServerConfigure) GetIndex() string               { return cfg.absPath(cfg.Index) }
 func (cfg *ServerConfigure) GetMultipartMaxMemory() int64   { return cfg.MultipartMaxMemory }
 func (cfg *ServerConfigure) GetMultipartTempPath() string   { return cfg.MultipartTempPath }
+func (cfg *ServerConfigure) GetProxyNextUpstream() []string { return cfg.ProxyNextUpstream }
 func (cfg *ServerConfigure) GetProxyNextUpstreamTries() int { return cfg.ProxyNextUpstreamTries }
+func (cfg *ServerConfigure) GetClientBodyBufferSize() int64 { return cfg.ClientBodyBufferSize }
+func (cfg *ServerConfigure) GetProxyBuffering() bool        { return cfg.ProxyBuffering != SWITCH_OFF }
+func (cfg *ServerConfigure) GetProxyXForwardedFor() string  { return cfg.ProxyXForwardedFor }
+func (cfg *ServerConfigure) GetProxyForwarded() bool        { return cfg.ProxyForwarded == SWITCH_ON }
+func (cfg *ServerConfigure) GetProxySetHost() string        { return cfg.ProxySetHost }
+func (cfg *ServerConfigure) GetProxyRedirect() []string     { return cfg.ProxyRedirect }
+func (cfg *ServerConfigure) GetProxyCookieDomain() []string { return cfg.ProxyCookieDomain }
+func (cfg *ServerConfigure) GetProxyCookiePath() []string   { return cfg.ProxyCookiePath }
 func (cfg *ServerConfigure) GetPProfEnable() bool           { return cfg.PProfEnable }
 func (cfg *ServerConfigure) GetPProfPrefix() string         { return cfg.PProfPrefix }
 func (cfg *ServerConfigure) GetEnableTLS() bool             { return cfg.EnableTLS }
+func (cfg *ServerConfigure) GetEnableHTTP3() bool           { return cfg.EnableHTTP3 }
 func (cfg *ServerConfigure) GetTLSCertFile() string         { return cfg.TLSCertFile }
 func (cfg *ServerConfigure) GetTLSKeyFile() string          { return cfg.TLSKeyFile }
+func (cfg *ServerConfigure) GetCertificates() []Certificate { return cfg.Certificates }
 func (cfg *ServerConfigure) GetConfig() *ModuleConfig       { return &ModuleConfig{m: cfg.Config} }
 
+func (cfg *ServerConfigure) GetHTTP2() bool                     { return cfg.HTTP2 != SWITCH_OFF }
+func (cfg *ServerConfigure) GetH2C() bool                       { return cfg.H2C == SWITCH_ON }
+func (cfg *ServerConfigure) GetHTTP2MaxConcurrentStreams() int  { return cfg.HTTP2MaxConcurrentStreams }
+func (cfg *ServerConfigure) GetHTTP2MaxReadFrameSize() int      { return cfg.HTTP2MaxReadFrameSize }
+func (cfg *ServerConfigure) GetHTTP2IdleTimeout() time.Duration { return cfg.http2IdleTimeout }
+
+// checkRewrites validates the rewrite rules, each of them is either
+// "off" (as the only rule), "default" (if allowed) or "<from> <to>".
+func checkRewrites(name string, rules []string, allowDefault bool) error {
+	for _, rule := range rules {
+		items := strings.Fields(rule)
+		switch {
+		case len(items) == 2:
+		case rule == SWITCH_OFF && len(rules) == 1:
+		case rule == PROXY_REDIRECT_DEFAULT && allowDefault:
+		default:
+			return fmt.Errorf("invalid %s '%s'", name, rule)
+		}
+	}
+	return nil
+}
+
+func (cfg *ServerConfigure) parse() error {
+	for _, condition := range cfg.ProxyNextUpstream {
+		if !PROXY_NEXT_UPSTREAM_CONDITIONS[condition] {
+			return fmt.Errorf("server %s: invalid proxy_next_upstream '%s'",
+				cfg.Name, condition)
+		}
+	}
+
+	if cfg.ProxyBuffering != SWITCH_ON && cfg.ProxyBuffering != SWITCH_OFF {
+		return fmt.Errorf("server %s: invalid proxy_buffering '%s'",
+			cfg.Name, cfg.ProxyBuffering)
+	}
+
+	switch cfg.ProxyXForwardedFor {
+	case X_FORWARDED_FOR_APPEND, X_FORWARDED_FOR_OVERWRITE, X_FORWARDED_FOR_OFF:
+	default:
+		return fmt.Errorf("server %s: invalid proxy_x_forwarded_for '%s'",
+			cfg.Name, cfg.ProxyXForwardedFor)
+	}
+
+	if cfg.ProxyForwarded != SWITCH_ON && cfg.ProxyForwarded != SWITCH_OFF {
+		return fmt.Errorf("server %s: invalid proxy_forwarded '%s'",
+			cfg.Name, cfg.ProxyForwarded)
+	}
+
+	err := checkRewrites("proxy_redirect", cfg.ProxyRedirect, true)
+	if err == nil {
+		err = checkRewrites("proxy_cookie_domain", cfg.ProxyCookieDomain, false)
+	}
+	if err == nil {
+		err = checkRewrites("proxy_cookie_path", cfg.ProxyCookiePath, false)
+	}
+	if err != nil {
+		return fmt.Errorf("server %s: %v", cfg.Name, err)
+	}
+
+	cfg.flushInterval, err = parseDuration(cfg.FlushInterval)
+	if err != nil || cfg.flushInterval < 0 {
+		return fmt.Errorf("server %s: invalid flush_interval '%s'",
+			cfg.Name, cfg.FlushInterval)
+	}
+
+	err = cfg.parseHTTP2()
+	if err != nil {
+		return fmt.Errorf("server %s: %v", cfg.Name, err)
+	} else if cfg.EnableHTTP3 && !cfg.EnableTLS {
+		return fmt.Errorf("server %s: enable_http3 requires enable_tls", cfg.Name)
+	}
+
+	err = cfg.checkCertificates()
+	if err != nil {
+		return fmt.Errorf("server %s: %v", cfg.Name, err)
+	}
+	return nil
+}
+
+// checkCertificates validates the SNI certificates, the wildcard
+// is only allowed as the leftmost label, e.g. *.example.com.
+func (cfg *ServerConfigure) checkCertificates() error {
+	names := map[string]bool{}
+	for i, certificate := range cfg.Certificates {
+		name := strings.ToLower(certificate.Name)
+		if len(name) == 0 || strings.Contains(strings.TrimPrefix(name, "*."), "*") {
+			return fmt.Errorf("invalid certificate name '%s'", certificate.Name)
+		} else if names[name] {
+			return fmt.Errorf("duplicate certificate name '%s'", certificate.Name)
+		} else if len(certificate.CertFile) == 0 || len(certificate.KeyFile) == 0 {
+			return fmt.Errorf("certificate %s: cert_file and key_file are required", certificate.Name)
+		}
+		names[name] = true
+		cfg.Certificates[i].Name = name
+	}
+	return nil
+}
+
+// parseHTTP2 validates the HTTP/2 settings, http2 applies to TLS listener
+// (negotiated by ALPN) and h2c applies to cleartext listener.
+func (cfg *ServerConfigure) parseHTTP2() error {
+	if cfg.HTTP2 != SWITCH_ON && cfg.HTTP2 != SWITCH_OFF {
+		return fmt.Errorf("invalid http2 '%s'", cfg.HTTP2)
+	} else if cfg.H2C != SWITCH_ON && cfg.H2C != SWITCH_OFF {
+		return fmt.Errorf("invalid h2c '%s'", cfg.H2C)
+	} else if cfg.HTTP2MaxConcurrentStreams <= 0 {
+		return fmt.Errorf("invalid http2_max_concurrent_streams '%d'",
+			cfg.HTTP2MaxConcurrentStreams)
+	} else if cfg.HTTP2MaxReadFrameSize < 16384 || cfg.HTTP2MaxReadFrameSize > 16777215 {
+		// see RFC 7540 section 4.2
+		return fmt.Errorf("invalid http2_max_read_frame_size '%d'",
+			cfg.HTTP2MaxReadFrameSize)
+	}
+
+	var err error
+	cfg.http2IdleTimeout, err = parseDuration(cfg.HTTP2IdleTimeout)
+	if err != nil || cfg.http2IdleTimeout < 0 {
+		return fmt.Errorf("invalid http2_idle_timeout '%s'", cfg.HTTP2IdleTimeout)
+	}
+	return nil
+}
+
 func (cfg *ServerConfigure) GetProxyConnectTimeout() time.Duration {
 	return time.Duration(cfg.ProxyConnectTimeout) * time.Second
 }
@@ -73,6 +239,10 @@ func (cfg *ServerConfigure) GetProxyReadTimeout() time.Duration {
 	return time.Duration(cfg.ProxyReadTimeout) * time.Second
 }
 
+func (cfg *ServerConfigure) GetFlushInterval() time.Duration {
+	return cfg.flushInterval
+}
+
 func (cfg *ModuleConfig) GetInt(key string) int {
 	v, ok := cfg.m[key]
 	if !ok {
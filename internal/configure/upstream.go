@@ -0,0 +1,473 @@
+/*
+ *  Copyright (c) 2022 NetEase Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+/*
+ * Project: Pigeon
+ * Created Date: 2026-10-18
+ */
+
+package configure
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	UpstreamConfigure = Upstream
+
+	Peer struct {
+		Address     string
+		Weight      int
+		MaxFails    int
+		FailTimeout time.Duration
+		SlowStart   time.Duration
+		Backup      bool
+		Down        bool
+	}
+
+	Balance struct {
+		Method     string
+		Key        string // variables of hash key, e.g. $request_uri
+		Consistent bool
+	}
+
+	Sticky struct {
+		Cookie   string
+		Expires  time.Duration // 0 means session cookie
+		Domain   string
+		Path     string
+		HttpOnly bool
+		Secure   bool
+	}
+)
+
+const (
+	SCHEME_HTTP  = "http"
+	SCHEME_HTTPS = "https"
+
+	CHECK_TYPE_TCP  = "tcp"
+	CHECK_TYPE_HTTP = "http"
+
+	UNIX_SOCKET_PREFIX = "unix:"
+
+	BALANCE_ROUND_ROBIN = "round_robin"
+	BALANCE_IP_HASH     = "ip_hash"
+	BALANCE_HASH        = "hash"
+	BALANCE_RANDOM_TWO  = "random_two"
+	BALANCE_LEAST_CONN  = "least_conn"
+	BALANCE_LEAST_TIME  = "least_time"
+
+	DEFAULT_PEER_WEIGHT       = 1
+	DEFAULT_PEER_MAX_FAILS    = 1
+	DEFAULT_PEER_FAIL_TIMEOUT = 10 * time.Second
+)
+
+var (
+	TLS_VERSIONS = map[string]uint16{
+		"TLSv1":   tls.VersionTLS10,
+		"TLSv1.1": tls.VersionTLS11,
+		"TLSv1.2": tls.VersionTLS12,
+		"TLSv1.3": tls.VersionTLS13,
+	}
+)
+
+func (cfg *UpstreamConfigure) GetName() string      { return cfg.Name }
+func (cfg *UpstreamConfigure) GetServers() []string { return cfg.Servers }
+func (cfg *UpstreamConfigure) GetPeers() []Peer     { return cfg.peers }
+func (cfg *UpstreamConfigure) GetBalance() Balance  { return cfg.balance }
+func (cfg *UpstreamConfigure) GetMirror() string    { return cfg.Mirror }
+func (cfg *UpstreamConfigure) GetSticky() *Sticky   { return cfg.sticky }
+
+func (cfg *UpstreamConfigure) GetHedgeDelay() time.Duration        { return cfg.hedgeDelay }
+func (cfg *UpstreamConfigure) GetRetryBudget() int                 { return cfg.retryBudget }
+func (cfg *UpstreamConfigure) GetRetryBudgetMin() int              { return cfg.RetryBudgetMin }
+func (cfg *UpstreamConfigure) GetRetryBudgetWindow() time.Duration { return cfg.retryBudgetWindow }
+
+func (cfg *UpstreamConfigure) GetResolveInterval() time.Duration { return cfg.resolveInterval }
+func (cfg *UpstreamConfigure) GetResolver() string               { return cfg.Resolver }
+
+func (cfg *UpstreamConfigure) GetKeepalive() int                  { return cfg.keepalive }
+func (cfg *UpstreamConfigure) GetKeepaliveTimeout() time.Duration { return cfg.keepaliveTimeout }
+func (cfg *UpstreamConfigure) GetKeepaliveRequests() int          { return cfg.KeepaliveRequests }
+func (cfg *UpstreamConfigure) GetMaxConns() int                   { return cfg.MaxConns }
+
+func (cfg *UpstreamConfigure) GetScheme() string                 { return cfg.Scheme }
+func (cfg *UpstreamConfigure) GetProxySSLTrustedCA() string      { return cfg.ProxySSLTrustedCA }
+func (cfg *UpstreamConfigure) GetProxySSLCertificate() string    { return cfg.ProxySSLCertificate }
+func (cfg *UpstreamConfigure) GetProxySSLCertificateKey() string { return cfg.ProxySSLCertificateKey }
+func (cfg *UpstreamConfigure) GetProxySSLServerName() string     { return cfg.ProxySSLServerName }
+func (cfg *UpstreamConfigure) GetProxySSLVerify() bool           { return cfg.ProxySSLVerify != SWITCH_OFF }
+func (cfg *UpstreamConfigure) GetProxySSLMinVersion() uint16     { return cfg.sslMinVersion }
+
+func (cfg *UpstreamConfigure) GetCheckInterval() time.Duration { return cfg.checkInterval }
+func (cfg *UpstreamConfigure) GetCheckTimeout() time.Duration  { return cfg.checkTimeout }
+func (cfg *UpstreamConfigure) GetCheckRise() int               { return cfg.CheckRise }
+func (cfg *UpstreamConfigure) GetCheckFall() int               { return cfg.CheckFall }
+func (cfg *UpstreamConfigure) GetCheckType() string            { return cfg.CheckType }
+func (cfg *UpstreamConfigure) GetCheckHTTPPath() string        { return cfg.CheckHTTPPath }
+func (cfg *UpstreamConfigure) GetCheckHTTPStatus() []string    { return cfg.CheckHTTPStatus }
+
+// parseDuration accepts both golang duration (e.g. 10s, 1m30s)
+// and nginx style plain number which means seconds.
+func parseDuration(value string) (time.Duration, error) {
+	if n, ok := strconv.Atoi(value); ok == nil {
+		return time.Duration(n) * time.Second, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// checkAddress validates the peer address, which is either
+// host:port or unix domain socket path prefixed with "unix:".
+func checkAddress(address string) error {
+	if strings.HasPrefix(address, UNIX_SOCKET_PREFIX) {
+		if !strings.HasPrefix(address[len(UNIX_SOCKET_PREFIX):], "/") {
+			return fmt.Errorf("invalid address '%s': socket path must be absolute", address)
+		}
+		return nil
+	}
+
+	_, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("invalid address '%s': %v", address, err)
+	}
+	return nil
+}
+
+// parsePeer parses nginx style server line, e.g.:
+//
+//	127.0.0.1:9000 weight=3 max_fails=2 fail_timeout=10s slow_start=30s backup down
+//	unix:/run/app.sock weight=2
+func parsePeer(line string) (Peer, error) {
+	peer := Peer{
+		Weight:      DEFAULT_PEER_WEIGHT,
+		MaxFails:    DEFAULT_PEER_MAX_FAILS,
+		FailTimeout: DEFAULT_PEER_FAIL_TIMEOUT,
+	}
+	items := strings.Fields(line)
+	if len(items) == 0 {
+		return peer, fmt.Errorf("empty server")
+	}
+
+	peer.Address = items[0]
+	err := checkAddress(peer.Address)
+	if err != nil {
+		return peer, err
+	}
+
+	for _, item := range items[1:] {
+		key, value, hasValue := strings.Cut(item, "=")
+		switch {
+		case key == "backup" && !hasValue:
+			peer.Backup = true
+		case key == "down" && !hasValue:
+			peer.Down = true
+		case key == "weight" && hasValue:
+			peer.Weight, err = strconv.Atoi(value)
+			if err != nil || peer.Weight <= 0 {
+				return peer, fmt.Errorf("invalid weight '%s'", value)
+			}
+		case key == "max_fails" && hasValue:
+			peer.MaxFails, err = strconv.Atoi(value)
+			if err != nil || peer.MaxFails < 0 {
+				return peer, fmt.Errorf("invalid max_fails '%s'", value)
+			}
+		case key == "fail_timeout" && hasValue:
+			peer.FailTimeout, err = parseDuration(value)
+			if err != nil || peer.FailTimeout < 0 {
+				return peer, fmt.Errorf("invalid fail_timeout '%s'", value)
+			}
+		case key == "slow_start" && hasValue:
+			peer.SlowStart, err = parseDuration(value)
+			if err != nil || peer.SlowStart < 0 {
+				return peer, fmt.Errorf("invalid slow_start '%s'", value)
+			}
+		default:
+			return peer, fmt.Errorf("invalid parameter '%s'", item)
+		}
+	}
+	return peer, nil
+}
+
+// checkStatus validates the expected status of http probe,
+// which is either a status code (e.g. 200) or a class (e.g. 2xx).
+func checkStatus(status string) error {
+	if len(status) != 3 || status[0] < '1' || status[0] > '5' {
+		return fmt.Errorf("invalid check_http_status '%s'", status)
+	} else if status[1:] == "xx" {
+		return nil
+	} else if _, err := strconv.Atoi(status[1:]); err != nil {
+		return fmt.Errorf("invalid check_http_status '%s'", status)
+	}
+	return nil
+}
+
+// parseBalance parses the balance method, e.g.:
+//
+//	ip_hash
+//	hash $request_uri consistent
+//	random_two
+//	least_conn
+//	least_time
+func parseBalance(line string) (Balance, error) {
+	balance := Balance{}
+	items := strings.Fields(line)
+	if len(items) == 0 {
+		return balance, fmt.Errorf("empty balance")
+	}
+
+	balance.Method = items[0]
+	switch {
+	case balance.Method == BALANCE_HASH && len(items) == 2:
+		balance.Key = items[1]
+	case balance.Method == BALANCE_HASH && len(items) == 3 && items[2] == "consistent":
+		balance.Key = items[1]
+		balance.Consistent = true
+	case balance.Method == BALANCE_HASH:
+		return balance, fmt.Errorf("invalid balance '%s'", line)
+	case len(items) != 1:
+		return balance, fmt.Errorf("invalid balance '%s'", line)
+	}
+
+	switch balance.Method {
+	case BALANCE_ROUND_ROBIN, BALANCE_IP_HASH, BALANCE_RANDOM_TWO,
+		BALANCE_LEAST_CONN, BALANCE_LEAST_TIME:
+	case BALANCE_HASH:
+		if !strings.Contains(balance.Key, "$") {
+			return balance, fmt.Errorf("hash key '%s' contains no variable", balance.Key)
+		}
+	default:
+		return balance, fmt.Errorf("unknown balance method '%s'", balance.Method)
+	}
+	return balance, nil
+}
+
+// parseSticky parses the sticky session, e.g.:
+//
+//	cookie srv_id expires=1h domain=.example.com path=/ httponly secure
+func parseSticky(line string) (*Sticky, error) {
+	items := strings.Fields(line)
+	if len(items) < 2 || items[0] != "cookie" {
+		return nil, fmt.Errorf("invalid sticky '%s'", line)
+	}
+
+	var err error
+	sticky := &Sticky{Cookie: items[1]}
+	for _, item := range items[2:] {
+		key, value, hasValue := strings.Cut(item, "=")
+		switch {
+		case key == "expires" && hasValue:
+			sticky.Expires, err = parseDuration(value)
+			if err != nil || sticky.Expires <= 0 {
+				return nil, fmt.Errorf("invalid sticky expires '%s'", value)
+			}
+		case key == "domain" && hasValue:
+			sticky.Domain = value
+		case key == "path" && hasValue:
+			sticky.Path = value
+		case key == "httponly" && !hasValue:
+			sticky.HttpOnly = true
+		case key == "secure" && !hasValue:
+			sticky.Secure = true
+		default:
+			return nil, fmt.Errorf("invalid sticky parameter '%s'", item)
+		}
+	}
+	return sticky, nil
+}
+
+// parseKeepalive parses the connection pool settings,
+// keepalive is the maximum idle connections or off.
+func (cfg *UpstreamConfigure) parseKeepalive() error {
+	var err error
+	cfg.keepalive = 0
+	if cfg.Keepalive != SWITCH_OFF {
+		cfg.keepalive, err = strconv.Atoi(cfg.Keepalive)
+		if err != nil || cfg.keepalive <= 0 {
+			return fmt.Errorf("invalid keepalive '%s'", cfg.Keepalive)
+		}
+	}
+
+	cfg.keepaliveTimeout, err = parseDuration(cfg.KeepaliveTimeout)
+	if err != nil || cfg.keepaliveTimeout <= 0 {
+		return fmt.Errorf("invalid keepalive_timeout '%s'", cfg.KeepaliveTimeout)
+	} else if cfg.KeepaliveRequests <= 0 {
+		return fmt.Errorf("invalid keepalive_requests '%d'", cfg.KeepaliveRequests)
+	} else if cfg.MaxConns < 0 {
+		return fmt.Errorf("invalid max_conns '%d'", cfg.MaxConns)
+	}
+	return nil
+}
+
+func (cfg *UpstreamConfigure) parseSSL() error {
+	if cfg.Scheme != "" && cfg.Scheme != SCHEME_HTTP && cfg.Scheme != SCHEME_HTTPS {
+		return fmt.Errorf("invalid scheme '%s'", cfg.Scheme)
+	} else if (len(cfg.ProxySSLCertificate) == 0) != (len(cfg.ProxySSLCertificateKey) == 0) {
+		return fmt.Errorf("proxy_ssl_certificate and proxy_ssl_certificate_key must be set together")
+	} else if cfg.ProxySSLVerify != SWITCH_ON && cfg.ProxySSLVerify != SWITCH_OFF {
+		return fmt.Errorf("invalid proxy_ssl_verify '%s'", cfg.ProxySSLVerify)
+	}
+
+	version, ok := TLS_VERSIONS[cfg.ProxySSLMinVersion]
+	if !ok {
+		return fmt.Errorf("invalid proxy_ssl_min_version '%s'", cfg.ProxySSLMinVersion)
+	}
+	cfg.sslMinVersion = version
+	return nil
+}
+
+// parseRetry parses the hedge delay (0 means no hedging) and the retry
+// budget, which is the percentage of requests (e.g. 20%) that retries and
+// hedges may take in the window, off (i.e. -1) means unlimited.
+func (cfg *UpstreamConfigure) parseRetry() error {
+	var err error
+	cfg.hedgeDelay, err = parseDuration(cfg.HedgeDelay)
+	if err != nil || cfg.hedgeDelay < 0 {
+		return fmt.Errorf("invalid hedge_delay '%s'", cfg.HedgeDelay)
+	}
+
+	cfg.retryBudget = -1
+	if cfg.RetryBudget != SWITCH_OFF {
+		cfg.retryBudget, err = strconv.Atoi(strings.TrimSuffix(cfg.RetryBudget, "%"))
+		if err != nil || cfg.retryBudget < 0 {
+			return fmt.Errorf("invalid retry_budget '%s'", cfg.RetryBudget)
+		}
+	}
+
+	cfg.retryBudgetWindow, err = parseDuration(cfg.RetryBudgetWindow)
+	if err != nil || cfg.retryBudgetWindow < time.Second {
+		return fmt.Errorf("invalid retry_budget_window '%s'", cfg.RetryBudgetWindow)
+	} else if cfg.RetryBudgetMin < 0 {
+		return fmt.Errorf("invalid retry_budget_min '%d'", cfg.RetryBudgetMin)
+	}
+	return nil
+}
+
+// parseResolve parses the interval of re-resolving hostname peers (0 means
+// never) and the DNS server's address, which is system's resolver if empty.
+func (cfg *UpstreamConfigure) parseResolve() error {
+	var err error
+	cfg.resolveInterval, err = parseDuration(cfg.Resolve)
+	if err != nil || cfg.resolveInterval < 0 {
+		return fmt.Errorf("invalid resolve '%s'", cfg.Resolve)
+	} else if len(cfg.Resolver) == 0 {
+		return nil
+	}
+
+	if _, _, err = net.SplitHostPort(cfg.Resolver); err != nil {
+		cfg.Resolver = net.JoinHostPort(cfg.Resolver, "53")
+	}
+	if _, _, err = net.SplitHostPort(cfg.Resolver); err != nil {
+		return fmt.Errorf("invalid resolver '%s'", cfg.Resolver)
+	}
+	return nil
+}
+
+func (cfg *UpstreamConfigure) parseCheck() error {
+	var err error
+	cfg.checkInterval, err = parseDuration(cfg.CheckInterval)
+	if err != nil || cfg.checkInterval < 0 {
+		return fmt.Errorf("invalid check_interval '%s'", cfg.CheckInterval)
+	}
+	cfg.checkTimeout, err = parseDuration(cfg.CheckTimeout)
+	if err != nil || cfg.checkTimeout <= 0 {
+		return fmt.Errorf("invalid check_timeout '%s'", cfg.CheckTimeout)
+	}
+
+	if cfg.CheckRise <= 0 {
+		return fmt.Errorf("invalid rise '%d'", cfg.CheckRise)
+	} else if cfg.CheckFall <= 0 {
+		return fmt.Errorf("invalid fall '%d'", cfg.CheckFall)
+	} else if cfg.CheckType != CHECK_TYPE_TCP && cfg.CheckType != CHECK_TYPE_HTTP {
+		return fmt.Errorf("invalid check_type '%s'", cfg.CheckType)
+	} else if !strings.HasPrefix(cfg.CheckHTTPPath, "/") {
+		return fmt.Errorf("invalid check_http_path '%s'", cfg.CheckHTTPPath)
+	}
+
+	for _, status := range cfg.CheckHTTPStatus {
+		err = checkStatus(status)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cfg *UpstreamConfigure) parse() error {
+	if len(cfg.Name) == 0 {
+		return fmt.Errorf("upstream name is empty")
+	} else if len(cfg.Servers) == 0 {
+		return fmt.Errorf("upstream %s: no servers", cfg.Name)
+	}
+
+	primary := 0
+	cfg.peers = []Peer{}
+	for _, line := range cfg.Servers {
+		peer, err := parsePeer(line)
+		if err != nil {
+			return fmt.Errorf("upstream %s: %v", cfg.Name, err)
+		} else if !peer.Backup {
+			primary++
+		}
+		cfg.peers = append(cfg.peers, peer)
+	}
+	if primary == 0 {
+		return fmt.Errorf("upstream %s: no primary servers", cfg.Name)
+	}
+
+	var err error
+	cfg.balance, err = parseBalance(cfg.Balance)
+	if err != nil {
+		return fmt.Errorf("upstream %s: %v", cfg.Name, err)
+	}
+
+	if len(cfg.Sticky) > 0 {
+		cfg.sticky, err = parseSticky(cfg.Sticky)
+		if err != nil {
+			return fmt.Errorf("upstream %s: %v", cfg.Name, err)
+		}
+	}
+
+	err = cfg.parseRetry()
+	if err != nil {
+		return fmt.Errorf("upstream %s: %v", cfg.Name, err)
+	}
+
+	err = cfg.parseKeepalive()
+	if err != nil {
+		return fmt.Errorf("upstream %s: %v", cfg.Name, err)
+	}
+
+	err = cfg.parseSSL()
+	if err != nil {
+		return fmt.Errorf("upstream %s: %v", cfg.Name, err)
+	}
+
+	err = cfg.parseResolve()
+	if err != nil {
+		return fmt.Errorf("upstream %s: %v", cfg.Name, err)
+	}
+
+	err = cfg.parseCheck()
+	if err != nil {
+		return fmt.Errorf("upstream %s: %v", cfg.Name, err)
+	}
+	return nil
+}
@@ -116,13 +116,29 @@ func (pigeon *Pigeon) Start(filename string) (err error) {
 	}
 
 	// 5. start server in child process
+	for _, server := range pigeon.Servers() {
+		if server.Enable() {
+			server.Start()
+		}
+	}
 	defer func() { pigeon.Shutdown() }()
 	err = gracehttp.ServeWithOptions(servers,
 		gracehttp.StopTimeout(cfg.GetCloseTimeout()),
-		gracehttp.KillTimeout(cfg.GetAbortTimeout()))
+		gracehttp.KillTimeout(cfg.GetAbortTimeout()),
+		gracehttp.PreStartProcess(pigeon.release))
 	return err
 }
 
+// release releases what the new process needs on reload, see HTTPServer.Release.
+func (pigeon *Pigeon) release() error {
+	for _, server := range pigeon.Servers() {
+		if server.Enable() {
+			server.Release()
+		}
+	}
+	return nil
+}
+
 func (pigeon *Pigeon) parse(filename string) (*configure.Configure, error) {
 	ctx := configure.Context{
 		Version: pigeon.Version(),
@@ -0,0 +1,336 @@
+/*
+ *  Copyright (c) 2022 NetEase Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+/*
+ * Project: Pigeon
+ * Created Date: 2026-10-18
+ */
+
+package http
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"hash/crc32"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/opencurve/pigeon/internal/configure"
+)
+
+const (
+	// see nginx's ngx_http_upstream_hash_module.c
+	HASH_MAX_TRIES = 20
+	// virtual nodes per weight on the consistent hash ring, each md5
+	// digest yields 4 points as ketama does
+	HASH_RING_DIGESTS = 40
+)
+
+type (
+	// balancer selects a peer from the peers it built with, the tried peers
+	// are skipped. All methods are invoked under the upstream's mutex.
+	balancer interface {
+		next(key string, now time.Time, tried []*Peer) *Peer
+		score(peer *Peer) string
+	}
+
+	roundRobin struct {
+		peers []*Peer
+	}
+
+	hashBalancer struct {
+		peers    []*Peer
+		total    int
+		fallback balancer
+	}
+
+	hashPoint struct {
+		hash uint32
+		peer *Peer
+	}
+
+	consistentHash struct {
+		points []hashPoint
+	}
+
+	randomTwo struct {
+		peers []*Peer
+	}
+
+	// leastBalancer selects the peer with the lowest load,
+	// ties are broken by weighted round-robin
+	leastBalancer struct {
+		peers []*Peer
+		load  func(peer *Peer, now time.Time) float64
+	}
+)
+
+func newBalancer(balance configure.Balance, peers []*Peer) balancer {
+	switch balance.Method {
+	case configure.BALANCE_IP_HASH, configure.BALANCE_HASH:
+		if balance.Consistent {
+			return newConsistentHash(peers)
+		}
+		return newHashBalancer(peers)
+	case configure.BALANCE_RANDOM_TWO:
+		return &randomTwo{peers: peers}
+	case configure.BALANCE_LEAST_CONN:
+		return &leastBalancer{peers: peers, load: connsLoad}
+	case configure.BALANCE_LEAST_TIME:
+		return &leastBalancer{peers: peers, load: timeLoad}
+	}
+	return &roundRobin{peers: peers}
+}
+
+// next picks the peer with the highest current weight,
+// which spreads requests smoothly in proportion to the peer weights:
+// weights {5, 1, 1} yield a, a, b, a, c, a, a instead of a, a, a, a, a, b, c.
+func (b *roundRobin) next(key string, now time.Time, tried []*Peer) *Peer {
+	var best *Peer
+	total := 0.0
+	for _, peer := range b.peers {
+		if !peer.available(now) || isTried(peer, tried) {
+			continue
+		}
+
+		weight := peer.scale(peer.effectiveWeight, now)
+		peer.currentWeight += weight
+		total += weight
+		if peer.effectiveWeight < peer.Weight {
+			peer.effectiveWeight++
+		}
+		if best == nil || peer.currentWeight > best.currentWeight {
+			best = peer
+		}
+	}
+
+	if best != nil {
+		best.currentWeight -= total
+	}
+	return best
+}
+
+func (b *roundRobin) score(peer *Peer) string { return "-" }
+
+func newHashBalancer(peers []*Peer) *hashBalancer {
+	total := 0
+	for _, peer := range peers {
+		total += peer.Weight
+	}
+	return &hashBalancer{
+		peers:    peers,
+		total:    total,
+		fallback: &roundRobin{peers: peers},
+	}
+}
+
+// next maps the key to a peer in proportion to the peer weights, the key
+// is rehashed if the peer is unavailable, and it falls back to round-robin
+// after HASH_MAX_TRIES tries.
+func (b *hashBalancer) next(key string, now time.Time, tried []*Peer) *Peer {
+	if b.total == 0 {
+		return nil
+	}
+
+	for i := 0; i < HASH_MAX_TRIES; i++ {
+		data := key
+		if i > 0 {
+			data = strconv.Itoa(i) + key
+		}
+		w := int(crc32.ChecksumIEEE([]byte(data)) % uint32(b.total))
+		for _, peer := range b.peers {
+			w -= peer.Weight
+			if w >= 0 {
+				continue
+			} else if peer.available(now) && !isTried(peer, tried) {
+				return peer
+			}
+			break
+		}
+	}
+	return b.fallback.next(key, now, tried)
+}
+
+func (b *hashBalancer) score(peer *Peer) string { return "-" }
+
+// newConsistentHash builds a ketama style ring, every peer owns
+// weight * HASH_RING_DIGESTS * 4 virtual nodes, so removing a peer only
+// remaps the keys owned by it.
+func newConsistentHash(peers []*Peer) *consistentHash {
+	b := &consistentHash{points: []hashPoint{}}
+	for _, peer := range peers {
+		for i := 0; i < peer.Weight*HASH_RING_DIGESTS; i++ {
+			digest := md5.Sum([]byte(peer.Address + "-" + strconv.Itoa(i)))
+			for j := 0; j < 4; j++ {
+				b.points = append(b.points, hashPoint{
+					hash: binary.LittleEndian.Uint32(digest[j*4:]),
+					peer: peer,
+				})
+			}
+		}
+	}
+	sort.Slice(b.points, func(i, j int) bool {
+		return b.points[i].hash < b.points[j].hash
+	})
+	return b
+}
+
+// next walks the ring clockwise from the key's position
+// and picks the first available peer.
+func (b *consistentHash) next(key string, now time.Time, tried []*Peer) *Peer {
+	n := len(b.points)
+	if n == 0 {
+		return nil
+	}
+
+	digest := md5.Sum([]byte(key))
+	hash := binary.LittleEndian.Uint32(digest[:4])
+	start := sort.Search(n, func(i int) bool { return b.points[i].hash >= hash })
+	for i := 0; i < n; i++ {
+		peer := b.points[(start+i)%n].peer
+		if peer.available(now) && !isTried(peer, tried) {
+			return peer
+		}
+	}
+	return nil
+}
+
+func (b *consistentHash) score(peer *Peer) string { return "-" }
+
+// pick selects the index of a peer except the skipped one randomly
+// in proportion to the peer weights.
+func (b *randomTwo) pick(weights []float64, total float64, skip int) int {
+	w := rand.Float64() * total
+	picked := -1
+	for i, weight := range weights {
+		if i == skip {
+			continue
+		}
+		picked = i
+		if w -= weight; w < 0 {
+			break
+		}
+	}
+	return picked // the last one if w is left by rounding
+}
+
+// next picks two peers randomly and selects the less loaded one,
+// i.e. the power of two choices.
+func (b *randomTwo) next(key string, now time.Time, tried []*Peer) *Peer {
+	peers := []*Peer{}
+	weights := []float64{}
+	total := 0.0
+	for _, peer := range b.peers {
+		if peer.available(now) && !isTried(peer, tried) {
+			peers = append(peers, peer)
+			weights = append(weights, peer.scale(peer.Weight, now))
+			total += weights[len(weights)-1]
+		}
+	}
+	if len(peers) == 0 {
+		return nil
+	} else if len(peers) == 1 {
+		return peers[0]
+	}
+
+	first := b.pick(weights, total, -1)
+	second := b.pick(weights, total-weights[first], first)
+	// compare conns/weight without division
+	if float64(peers[second].conns)*weights[first] < float64(peers[first].conns)*weights[second] {
+		return peers[second]
+	}
+	return peers[first]
+}
+
+func (b *randomTwo) score(peer *Peer) string {
+	return strconv.Itoa(peer.conns)
+}
+
+// connsLoad is the in-flight requests per weight.
+func connsLoad(peer *Peer, now time.Time) float64 {
+	return float64(peer.conns) / peer.scale(peer.Weight, now)
+}
+
+// timeLoad is the expected time to serve a request: response time
+// multiplied by the in-flight requests (including the new one) per weight.
+func timeLoad(peer *Peer, now time.Time) float64 {
+	return peer.ewma * float64(peer.conns+1) / peer.scale(peer.Weight, now)
+}
+
+func (b *leastBalancer) next(key string, now time.Time, tried []*Peer) *Peer {
+	var least []*Peer
+	var min float64
+	for _, peer := range b.peers {
+		if !peer.available(now) || isTried(peer, tried) {
+			continue
+		}
+
+		load := b.load(peer, now)
+		if len(least) == 0 || load < min {
+			least = []*Peer{peer}
+			min = load
+		} else if load == min {
+			least = append(least, peer)
+		}
+	}
+
+	if len(least) == 0 {
+		return nil
+	} else if len(least) == 1 {
+		return least[0]
+	}
+	return (&roundRobin{peers: least}).next(key, now, tried)
+}
+
+func (b *leastBalancer) score(peer *Peer) string {
+	return strconv.FormatFloat(b.load(peer, time.Now()), 'f', 3, 64)
+}
+
+func isTried(peer *Peer, tried []*Peer) bool {
+	for _, p := range tried {
+		if p == peer {
+			return true
+		}
+	}
+	return false
+}
+
+// ipHashKey uses the first three octets of IPv4 address as nginx does,
+// so clients in the same /24 network are served by the same peer.
+func ipHashKey(addr string) string {
+	ip := net.ParseIP(addr)
+	if ip4 := ip.To4(); ip4 != nil {
+		return string(ip4[:3])
+	} else if ip != nil {
+		return string(ip)
+	}
+	return addr
+}
+
+// hashKey returns the hash key of the request for hash based balancer.
+func (u *Upstream) hashKey(r *Request) string {
+	balance := u.cfg.GetBalance()
+	switch balance.Method {
+	case configure.BALANCE_IP_HASH:
+		return ipHashKey(r.Var.RemoteAddr)
+	case configure.BALANCE_HASH:
+		return r.expandVariables(balance.Key)
+	}
+	return ""
+}
@@ -0,0 +1,113 @@
+/*
+ *  Copyright (c) 2022 NetEase Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+/*
+ * Project: Pigeon
+ * Created Date: 2026-10-18
+ */
+
+package http
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+type (
+	// replayBody keeps the request body read so far in memory (up to limit
+	// bytes), so that the body can be sent again to the next upstream peer.
+	replayBody struct {
+		mutex    sync.Mutex
+		reader   io.Reader
+		buffer   bytes.Buffer
+		limit    int64
+		overflow bool
+		eof      bool
+		last     *replayReader
+	}
+
+	// replayReader is the body of one attempt, the transport may still
+	// read it after the response returned, so the next attempt must wait
+	// until it's closed by the transport.
+	replayReader struct {
+		io.Reader
+		once   sync.Once
+		closed chan struct{}
+	}
+)
+
+func newReplayBody(reader io.Reader, limit int64) *replayBody {
+	return &replayBody{reader: reader, limit: limit}
+}
+
+func (b *replayBody) Read(p []byte) (int, error) {
+	n, err := b.reader.Read(p)
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.eof = b.eof || err == io.EOF
+	if n > 0 && !b.overflow {
+		if int64(b.buffer.Len()+n) > b.limit {
+			b.overflow = true
+			b.buffer = bytes.Buffer{}
+		} else {
+			b.buffer.Write(p[:n])
+		}
+	}
+	return n, err
+}
+
+// Replayable reports whether the whole body read so far is kept.
+func (b *replayBody) Replayable() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return !b.overflow
+}
+
+// Bytes returns a copy of the whole body,
+// it returns false if the body is not read to the end or not kept.
+func (b *replayBody) Bytes() ([]byte, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if !b.eof || b.overflow {
+		return nil, false
+	}
+	return append([]byte{}, b.buffer.Bytes()...), true
+}
+
+// Reader returns a reader from the beginning of the body, it replays the
+// buffered part first and continues with the remaining of the origin.
+// It returns false if the body read by last attempt is not kept.
+func (b *replayBody) Reader() (io.ReadCloser, bool) {
+	if b.last != nil {
+		<-b.last.closed
+	}
+	if !b.Replayable() {
+		return nil, false
+	}
+
+	var reader io.Reader = b
+	if b.buffer.Len() > 0 {
+		reader = io.MultiReader(bytes.NewReader(b.buffer.Bytes()), b)
+	}
+	b.last = &replayReader{Reader: reader, closed: make(chan struct{})}
+	return b.last, true
+}
+
+func (r *replayReader) Close() error {
+	r.once.Do(func() { close(r.closed) })
+	return nil
+}
@@ -0,0 +1,102 @@
+/*
+ *  Copyright (c) 2022 NetEase Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+/*
+ * Project: Pigeon
+ * Created Date: 2026-10-18
+ */
+
+package http
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	RETRY_BUDGET_BUCKETS = 10
+)
+
+// retryBudget caps the retries (including hedged requests) of upstream to
+// the percentage of requests within the sliding window, the minimum keeps
+// retrying possible under low traffic. The nil budget is unlimited.
+type retryBudget struct {
+	mutex    sync.Mutex
+	percent  int
+	min      int
+	width    time.Duration // width of each bucket
+	current  int64         // sequence of current bucket
+	requests [RETRY_BUDGET_BUCKETS]int
+	retries  [RETRY_BUDGET_BUCKETS]int
+}
+
+func newRetryBudget(percent, min int, window time.Duration) *retryBudget {
+	return &retryBudget{
+		percent: percent,
+		min:     min,
+		width:   window / RETRY_BUDGET_BUCKETS,
+	}
+}
+
+// rotate clears the buckets slid out of the window and returns
+// the index of current bucket, it must be invoked under the mutex.
+func (b *retryBudget) rotate(now time.Time) int {
+	seq := now.UnixNano() / int64(b.width)
+	if seq-b.current >= RETRY_BUDGET_BUCKETS {
+		b.requests = [RETRY_BUDGET_BUCKETS]int{}
+		b.retries = [RETRY_BUDGET_BUCKETS]int{}
+		b.current = seq
+	}
+	for b.current < seq {
+		b.current++
+		b.requests[b.current%RETRY_BUDGET_BUCKETS] = 0
+		b.retries[b.current%RETRY_BUDGET_BUCKETS] = 0
+	}
+	return int(seq % RETRY_BUDGET_BUCKETS)
+}
+
+// deposit counts a request of live traffic.
+func (b *retryBudget) deposit() {
+	if b == nil {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.requests[b.rotate(time.Now())]++
+}
+
+// withdraw takes a retry from the budget, it returns false
+// if the budget is exhausted.
+func (b *retryBudget) withdraw() bool {
+	if b == nil {
+		return true
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	index := b.rotate(time.Now())
+	requests, retries := 0, 0
+	for i := 0; i < RETRY_BUDGET_BUCKETS; i++ {
+		requests += b.requests[i]
+		retries += b.retries[i]
+	}
+	if retries >= b.min+requests*b.percent/100 {
+		return false
+	}
+	b.retries[index]++
+	return true
+}
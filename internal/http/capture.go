@@ -0,0 +1,215 @@
+/*
+ *  Copyright (c) 2022 NetEase Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+/*
+ * Project: Pigeon
+ * Created Date: 2026-10-18
+ */
+
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// maximum nesting depth of subrequests, same as OpenResty
+	CAPTURE_MAX_DEPTH = 200
+)
+
+var (
+	ErrCaptureHijack = errors.New("subrequest doesn't support hijack")
+	ErrCaptureDepth  = errors.New("subrequests nested too deep")
+)
+
+type (
+	// captureKey is the context key of subrequest, the value is its depth
+	captureKey struct{}
+
+	// Subrequest is the uri and options of subrequest for CaptureMulti,
+	// see Capture.
+	Subrequest struct {
+		Uri     string
+		Options []ProxyOption
+	}
+
+	// CaptureResponse is the response of subrequest.
+	CaptureResponse struct {
+		Status int
+		Header http.Header
+		Body   []byte
+	}
+
+	// captureWriter keeps the response of subrequest in memory.
+	captureWriter struct {
+		status int
+		header http.Header
+		body   bytes.Buffer
+	}
+)
+
+func (w *captureWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *captureWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *captureWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(p)
+}
+
+func (w *captureWriter) Flush() {}
+
+func (w *captureWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, ErrCaptureHijack
+}
+
+// IsSubrequest reports whether the request is issued by Capture.
+func (r *Request) IsSubrequest() bool {
+	return r.Context.Request.Context().Value(captureKey{}) != nil
+}
+
+// depth returns the nesting depth of subrequest, 0 for the main request.
+func (r *Request) depth() int {
+	depth, _ := r.Context.Request.Context().Value(captureKey{}).(int)
+	return depth
+}
+
+// newSubrequest creates the subrequest which inherits the request's
+// method, headers and body (if not overridden by options) like OpenResty.
+func (r *Request) newSubrequest(uri string, opts []ProxyOption) (*http.Request, error) {
+	parent := r.Context.Request
+	depth := r.depth() + 1
+	if depth > CAPTURE_MAX_DEPTH {
+		return nil, ErrCaptureDepth
+	}
+	path, args, _ := strings.Cut(uri, "?")
+	options := PorxyOptions{
+		Method: r.Method,
+		Uri:    path,
+		Args:   args,
+		Body:   r.BodyReader,
+		origin: true,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	header := r.headersIn.Clone()
+	if options.Headers != nil {
+		header = http.Header{}
+		for k, v := range options.Headers {
+			header.Set(k, v)
+		}
+	}
+	body, length, err := (&Proxy{options: options}).makeBody(header)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.WithValue(parent.Context(), captureKey{}, depth)
+	u := &url.URL{Path: options.Uri, RawQuery: options.Args}
+	request, err := http.NewRequestWithContext(ctx, options.Method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	request.Header = header
+	request.ContentLength = length
+	header.Del("Content-Length")
+	header.Del("Transfer-Encoding")
+	if body != nil && length >= 0 {
+		header.Set("Content-Length", strconv.FormatInt(length, 10))
+	}
+	request.Host = parent.Host
+	request.RemoteAddr = parent.RemoteAddr
+	request.TLS = parent.TLS
+	request.Proto = parent.Proto
+	request.ProtoMajor = parent.ProtoMajor
+	request.ProtoMinor = parent.ProtoMinor
+	return request, nil
+}
+
+// dispatch serves the subrequest by the server's router.
+func (r *Request) dispatch(request *http.Request) *CaptureResponse {
+	if request.Body != nil {
+		defer request.Body.Close()
+	}
+
+	w := &captureWriter{header: http.Header{}}
+	r.server.engine.ServeHTTP(w, request)
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return &CaptureResponse{
+		Status: w.status,
+		Header: w.header,
+		Body:   w.body.Bytes(),
+	}
+}
+
+// Capture issues a subrequest to the uri (with optional query string)
+// which is dispatched by the server's own router in process, and returns
+// the response. The subrequest inherits the request's method, headers
+// and body, they can be overridden by options (e.g. WithMethod, WithArgs,
+// WithHeaders, WithBody). The subrequest isn't written to access log.
+func (r *Request) Capture(uri string, opts ...ProxyOption) (*CaptureResponse, error) {
+	request, err := r.newSubrequest(uri, opts)
+	if err != nil {
+		return nil, err
+	}
+	return r.dispatch(request), nil
+}
+
+// CaptureMulti issues the subrequests in parallel and returns their
+// responses in the same order. The request's body can't be shared by
+// the subrequests, so it's not inherited.
+func (r *Request) CaptureMulti(subrequests ...Subrequest) ([]*CaptureResponse, error) {
+	requests := []*http.Request{}
+	for _, subrequest := range subrequests {
+		opts := append([]ProxyOption{r.WithBody(nil)}, subrequest.Options...)
+		request, err := r.newSubrequest(subrequest.Uri, opts)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, request)
+	}
+
+	var wg sync.WaitGroup
+	responses := make([]*CaptureResponse, len(requests))
+	for i, request := range requests {
+		wg.Add(1)
+		go func(i int, request *http.Request) {
+			defer wg.Done()
+			responses[i] = r.dispatch(request)
+		}(i, request)
+	}
+	wg.Wait()
+	return responses, nil
+}
@@ -0,0 +1,76 @@
+/*
+ *  Copyright (c) 2022 NetEase Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+/*
+ * Project: Pigeon
+ * Created Date: 2026-10-18
+ */
+
+package http
+
+import (
+	"crypto/tls"
+	"strings"
+)
+
+type (
+	// certificates selects the certificate by SNI, the exact name is
+	// preferred over the wildcard, and the default certificate is used
+	// if none matches or the client sends no SNI.
+	certificates struct {
+		exact    map[string]*tls.Certificate
+		wildcard map[string]*tls.Certificate // keyed by the name without "*."
+		fallback *tls.Certificate
+	}
+)
+
+func (s *HTTPServer) loadCertificates(fallback *tls.Certificate) (*certificates, error) {
+	c := &certificates{
+		exact:    map[string]*tls.Certificate{},
+		wildcard: map[string]*tls.Certificate{},
+		fallback: fallback,
+	}
+	for _, certificate := range s.cfg.GetCertificates() {
+		cert, err := tls.LoadX509KeyPair(certificate.CertFile, certificate.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.HasPrefix(certificate.Name, "*.") {
+			c.wildcard[certificate.Name[2:]] = &cert
+		} else {
+			c.exact[certificate.Name] = &cert
+		}
+	}
+	return c, nil
+}
+
+// get is the GetCertificate callback of tls.Config, the wildcard matches
+// exactly one label as RFC 6125 does, e.g. *.example.com matches
+// www.example.com but neither example.com nor a.www.example.com.
+func (c *certificates) get(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if cert, ok := c.exact[name]; ok {
+		return cert, nil
+	}
+
+	if _, parent, ok := strings.Cut(name, "."); ok {
+		if cert, ok := c.wildcard[parent]; ok {
+			return cert, nil
+		}
+	}
+	return c.fallback, nil
+}
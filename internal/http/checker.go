@@ -0,0 +1,193 @@
+/*
+ *  Copyright (c) 2022 NetEase Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+/*
+ * Project: Pigeon
+ * Created Date: 2026-10-18
+ */
+
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/opencurve/pigeon/internal/configure"
+	"github.com/opencurve/pigeon/internal/utils"
+	"github.com/opencurve/pigeon/pkg/log"
+	"go.uber.org/zap"
+)
+
+type checker struct {
+	upstream *Upstream
+	cfg      *configure.UpstreamConfigure
+	logger   *zap.Logger
+	client   *http.Client
+	stop     chan struct{}
+	once     sync.Once
+	wg       sync.WaitGroup
+}
+
+func newChecker(upstream *Upstream, logger *zap.Logger) *checker {
+	cfg := upstream.cfg
+	// probes share the TLS settings (see newTLSConfig) with proxying
+	var tlsCfg *tls.Config
+	if upstream.transport != nil {
+		tlsCfg = upstream.transport.roundTripper.TLSClientConfig.Clone()
+	}
+	return &checker{
+		upstream: upstream,
+		cfg:      cfg,
+		logger:   logger,
+		client: &http.Client{
+			Timeout: cfg.GetCheckTimeout(),
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+					network, address = dialAddress(network, address)
+					return (&net.Dialer{}).DialContext(ctx, network, address)
+				},
+				TLSClientConfig:   tlsCfg,
+				DisableKeepAlives: true,
+			},
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		stop: make(chan struct{}),
+	}
+}
+
+func matchStatus(patterns []string, code int) bool {
+	status := strconv.Itoa(code)
+	for _, pattern := range patterns {
+		if pattern == status ||
+			(pattern[1:] == "xx" && pattern[0] == status[0]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *checker) probeTCP(peer *Peer) error {
+	network, address := dialAddress("tcp", peer.Address)
+	conn, err := net.DialTimeout(network, address, c.cfg.GetCheckTimeout())
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func (c *checker) probeHTTP(peer *Peer) error {
+	scheme := utils.Choose(c.cfg.GetScheme() == configure.SCHEME_HTTPS,
+		configure.SCHEME_HTTPS, configure.SCHEME_HTTP)
+	url := scheme + "://" + urlHost(peer.Address) + c.cfg.GetCheckHTTPPath()
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	} else if isUnixSocket(peer.Address) {
+		request.Host = UNIX_SOCKET_DEFAULT_HOST
+	}
+
+	resp, err := c.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if !matchStatus(c.cfg.GetCheckHTTPStatus(), resp.StatusCode) {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (c *checker) probe(peer *Peer) error {
+	if c.cfg.GetCheckType() == configure.CHECK_TYPE_HTTP {
+		return c.probeHTTP(peer)
+	}
+	return c.probeTCP(peer)
+}
+
+// check probes the peer and flips its health state after
+// `rise` consecutive successes or `fall` consecutive failures.
+func (c *checker) check(peer *Peer) {
+	err := c.probe(peer)
+	if err == nil {
+		peer.falls = 0
+		peer.rises++
+		if !peer.isHealthy() && peer.rises >= c.cfg.GetCheckRise() {
+			peer.setHealthy(true)
+			c.logger.Warn("upstream peer is healthy",
+				log.Field("upstream", c.upstream.Name()),
+				log.Field("peer", peer.Address))
+		}
+		return
+	}
+
+	peer.rises = 0
+	peer.falls++
+	if peer.isHealthy() && peer.falls >= c.cfg.GetCheckFall() {
+		peer.setHealthy(false)
+		c.logger.Error("upstream peer is unhealthy",
+			log.Field("upstream", c.upstream.Name()),
+			log.Field("peer", peer.Address),
+			log.Field("error", err))
+	}
+}
+
+func (c *checker) checkAll() {
+	var wg sync.WaitGroup
+	for _, peer := range c.upstream.Peers() {
+		wg.Add(1)
+		go func(peer *Peer) {
+			defer wg.Done()
+			c.check(peer)
+		}(peer)
+	}
+	wg.Wait()
+}
+
+func (c *checker) run() {
+	defer c.wg.Done()
+	ticker := time.NewTicker(c.cfg.GetCheckInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.checkAll()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+func (c *checker) Start() {
+	c.wg.Add(1)
+	go c.run()
+}
+
+func (c *checker) Stop() {
+	c.once.Do(func() { close(c.stop) })
+	c.wg.Wait()
+}
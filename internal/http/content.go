@@ -24,6 +24,8 @@ package http
 
 import (
 	"io"
+	"net/http"
+	"time"
 )
 
 type content interface {
@@ -53,6 +55,13 @@ type (
 		reader io.Reader
 		size   int64
 	}
+
+	Stream struct {
+		reader        io.ReadCloser
+		trailer       http.Header
+		buffering     bool
+		flushInterval time.Duration
+	}
 )
 
 func (_ *Message) data() {}
@@ -60,3 +69,4 @@ func (_ *JSON) data()    {}
 func (_ *File) data()    {}
 func (_ *Reader) data()  {}
 func (_ *Buffer) data()  {}
+func (_ *Stream) data()  {}
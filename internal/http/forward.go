@@ -0,0 +1,146 @@
+/*
+ *  Copyright (c) 2022 NetEase Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+/*
+ * Project: Pigeon
+ * Created Date: 2026-10-18
+ */
+
+package http
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/opencurve/pigeon/internal/configure"
+	"golang.org/x/net/http/httpguts"
+)
+
+const (
+	PROXY_HOST_CLIENT = "$host" // pass the client's Host header to upstream
+)
+
+var (
+	// escapes of quoted-string, see RFC 7230, section 3.2.6
+	quotedPairs = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+	// hop-by-hop headers, see RFC 7230, section 6.1
+	hopHeaders = []string{
+		"Connection",
+		"Keep-Alive",
+		"Proxy-Connection",
+		"Proxy-Authenticate",
+		"Proxy-Authorization",
+		"Te",
+		"Trailer",
+		"Transfer-Encoding",
+		"Upgrade",
+	}
+)
+
+// removeHopHeaders removes hop-by-hop headers including the ones
+// listed in the Connection header.
+func removeHopHeaders(headers http.Header) {
+	for _, value := range headers["Connection"] {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); len(name) > 0 {
+				headers.Del(name)
+			}
+		}
+	}
+	for _, name := range hopHeaders {
+		headers.Del(name)
+	}
+}
+
+// forwardedNode formats the node identifier of RFC 7239,
+// IPv6 address must be quoted and enclosed in square brackets.
+func forwardedNode(ip string) string {
+	if strings.Contains(ip, ":") {
+		return `"[` + ip + `]"`
+	}
+	return ip
+}
+
+// forwardedValue formats the value of RFC 7239 forwarded-pair, which is
+// quoted unless it's a token, e.g. the host with port.
+func forwardedValue(value string) string {
+	for _, c := range value {
+		if !httpguts.IsTokenRune(c) {
+			return `"` + quotedPairs.Replace(value) + `"`
+		}
+	}
+	if len(value) == 0 {
+		return `""`
+	}
+	return value
+}
+
+// forwardHeaders builds the headers sent to upstream: hop-by-hop headers are
+// removed and the forwarding headers are added.
+func (r *Request) forwardHeaders(options *PorxyOptions) http.Header {
+	headers := r.headersIn.Clone()
+	if options.Headers != nil {
+		headers = http.Header{}
+		for k, v := range options.Headers {
+			headers.Set(k, v)
+		}
+	}
+	te := strings.Join(headers.Values("Te"), ",")
+	upgrade := upgradeType(headers)
+	removeHopHeaders(headers)
+
+	// gRPC requires "TE: trailers", and the upgrade request must keep its headers
+	if hasToken(te, "trailers") {
+		headers.Set("Te", "trailers")
+	}
+	if len(upgrade) > 0 {
+		headers.Set("Connection", "Upgrade")
+		headers.Set("Upgrade", upgrade)
+	}
+
+	ip := r.Var.RemoteAddr
+	switch options.ForwardedFor {
+	case configure.X_FORWARDED_FOR_APPEND:
+		if prior := headers.Values("X-Forwarded-For"); len(prior) > 0 {
+			ip = strings.Join(prior, ", ") + ", " + ip
+		}
+		fallthrough
+	case configure.X_FORWARDED_FOR_OVERWRITE:
+		headers.Set("X-Forwarded-For", ip)
+		headers.Set("X-Real-Ip", r.Var.RemoteAddr)
+		headers.Set("X-Forwarded-Proto", r.Scheme)
+	}
+
+	if options.Forwarded {
+		node := "for=" + forwardedNode(r.Var.RemoteAddr) +
+			";host=" + forwardedValue(r.Context.Request.Host) + ";proto=" + r.Scheme
+		if prior := headers.Values("Forwarded"); len(prior) > 0 {
+			node = strings.Join(prior, ", ") + ", " + node
+		}
+		headers.Set("Forwarded", node)
+	}
+	return headers
+}
+
+// proxyHost returns the Host header sent to upstream,
+// empty string means the upstream address.
+func (r *Request) proxyHost(host string) string {
+	if host == PROXY_HOST_CLIENT {
+		return r.Context.Request.Host
+	}
+	return host
+}
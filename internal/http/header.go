@@ -0,0 +1,117 @@
+/*
+ *  Copyright (c) 2022 NetEase Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+/*
+ * Project: Pigeon
+ * Created Date: 2026-10-18
+ */
+
+package http
+
+import (
+	"net/http"
+	"net/textproto"
+)
+
+// Header is a multi-valued header set which keeps every value of
+// a header (e.g. Set-Cookie, Via), the map view is kept in sync with
+// the first value of each key for compatibility with Request.HeadersIn
+// and Request.HeadersOut.
+type Header struct {
+	header http.Header
+	view   map[string]string
+}
+
+func newHeader(header http.Header) (*Header, map[string]string) {
+	view := map[string]string{}
+	for k, v := range header {
+		if len(v) > 0 {
+			view[k] = v[0]
+		}
+	}
+	return &Header{header: header, view: view}, view
+}
+
+func (h *Header) Get(key string) string {
+	h.sync()
+	return h.header.Get(key)
+}
+
+func (h *Header) Values(key string) []string {
+	h.sync()
+	return h.header.Values(key)
+}
+
+func (h *Header) Add(key, value string) {
+	h.sync()
+	key = textproto.CanonicalMIMEHeaderKey(key)
+	h.header.Add(key, value)
+	h.view[key] = h.header.Get(key)
+}
+
+func (h *Header) Set(key, value string) {
+	h.sync()
+	key = textproto.CanonicalMIMEHeaderKey(key)
+	h.header.Set(key, value)
+	h.view[key] = value
+}
+
+func (h *Header) Del(key string) {
+	h.sync()
+	key = textproto.CanonicalMIMEHeaderKey(key)
+	h.header.Del(key)
+	delete(h.view, key)
+}
+
+// Clone returns a copy of all headers.
+func (h *Header) Clone() http.Header {
+	h.sync()
+	return h.header.Clone()
+}
+
+// set replaces all values of the key
+func (h *Header) set(key string, values []string) {
+	h.sync()
+	key = textproto.CanonicalMIMEHeaderKey(key)
+	if len(values) == 0 {
+		return
+	}
+	h.header[key] = append([]string(nil), values...)
+	h.view[key] = values[0]
+}
+
+// sync applies the changes made through the map view: a key deleted
+// from the map is deleted, a key whose value changed is replaced.
+func (h *Header) sync() {
+	for k, v := range h.header {
+		value, ok := h.view[k]
+		if !ok {
+			delete(h.header, k)
+		} else if len(v) == 0 || v[0] != value {
+			h.header[k] = []string{value}
+		}
+	}
+	for k, v := range h.view {
+		key := textproto.CanonicalMIMEHeaderKey(k)
+		if key != k {
+			delete(h.view, k)
+			h.view[key] = v
+			h.header[key] = []string{v}
+		} else if _, ok := h.header[key]; !ok {
+			h.header[key] = []string{v}
+		}
+	}
+}
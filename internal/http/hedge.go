@@ -0,0 +1,146 @@
+/*
+ *  Copyright (c) 2022 NetEase Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+/*
+ * Project: Pigeon
+ * Created Date: 2026-10-18
+ */
+
+package http
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/opencurve/pigeon/pkg/log"
+)
+
+type (
+	// attempt is the request to an upstream peer and its result.
+	attempt struct {
+		peer   *Peer
+		score  string
+		resp   *http.Response
+		err    error
+		failed bool
+		retry  bool
+		cancel context.CancelFunc
+	}
+)
+
+// send sends the request to the peer and feeds the result back to upstream.
+// The request canceled (by hedging or client) isn't the peer's failure.
+func (a *attempt) send(ctx context.Context, upstream *Upstream,
+	options PorxyOptions, next nextUpstream) {
+	options.Address = a.peer.Address
+	a.score = upstream.Score(a.peer)
+	start := time.Now()
+	a.resp, a.err = NewProxy(ctx, upstream.transport, options).Do()
+	a.failed, a.retry = next.judge(a.resp, a.err)
+	if a.err != nil && ctx.Err() == context.Canceled {
+		a.failed, a.retry = false, false
+		upstream.Release(a.peer)
+		return
+	}
+	upstream.Free(a.peer, a.resp, a.failed, time.Since(start))
+}
+
+func (a *attempt) close() {
+	if a.resp != nil {
+		a.resp.Body.Close()
+	}
+}
+
+// hedgeable tells whether the request can be hedged, which must be
+// idempotent and not an upgrade. The body read from a reader can't be
+// sent by the attempts at the same time, in-memory body (e.g. []byte)
+// is fine as each attempt reads its own copy, see makeBody.
+func hedgeable(options PorxyOptions) bool {
+	if reader, ok := options.Body.(io.Reader); ok && reader != http.NoBody {
+		return false
+	}
+	return options.HedgeDelay > 0 &&
+		!nonIdempotentMethods[options.Method] &&
+		len(upgradeType(options.header)) == 0
+}
+
+// hedge sends the request to the peer, if no response arrives within the
+// hedge delay, a duplicate request is sent to another peer as long as the
+// retry budget allows. The first response which isn't failed wins and the
+// other one is canceled, the failed one is returned if both are failed.
+// It returns the result and the peers tried.
+func (r *Request) hedge(upstream *Upstream, peer *Peer, key string, tried []*Peer,
+	options PorxyOptions, next nextUpstream) (*attempt, []*Peer) {
+	results := make(chan *attempt, 2)
+	attempts := []*attempt{}
+	launch := func(peer *Peer) {
+		ctx, cancel := context.WithCancel(r.Context.Request.Context())
+		a := &attempt{peer: peer, cancel: cancel}
+		attempts = append(attempts, a)
+		go func() {
+			a.send(ctx, upstream, options, next)
+			results <- a
+		}()
+	}
+
+	launch(peer)
+	timer := time.NewTimer(options.HedgeDelay)
+	defer timer.Stop()
+	pending := 1
+	var a *attempt
+	for a == nil {
+		select {
+		case <-timer.C:
+			peer, err := upstream.Get(key, tried...)
+			if err != nil {
+				break
+			} else if !upstream.budget.withdraw() {
+				upstream.Release(peer)
+				r.Logger().Warn("retry budget exhausted, skip hedging",
+					log.Field("upstream", upstream.Name()))
+				break
+			}
+			tried = append(tried, peer)
+			launch(peer)
+			pending++
+		case result := <-results:
+			pending--
+			r.Var.addUpstream(result.peer.Address,
+				proxyStatus(result.resp, result.err), result.score)
+			if !result.failed || pending == 0 {
+				a = result
+			} else {
+				result.close()
+			}
+		}
+	}
+
+	// cancel the slower one, its result is discarded
+	for _, attempt := range attempts {
+		if attempt != a {
+			attempt.cancel()
+		}
+	}
+	if pending > 0 {
+		go func() {
+			result := <-results
+			result.close()
+		}()
+	}
+	return a, tried
+}
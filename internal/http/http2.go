@@ -0,0 +1,54 @@
+/*
+ *  Copyright (c) 2022 NetEase Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+/*
+ * Project: Pigeon
+ * Created Date: 2026-10-18
+ */
+
+package http
+
+import (
+	"crypto/tls"
+	"net/http"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// configureHTTP2 enables HTTP/2 for the server: over TLS it's negotiated
+// by ALPN if http2 is on, and over cleartext (i.e. h2c) it's accepted by
+// prior knowledge or upgrade if h2c is on.
+func (s *HTTPServer) configureHTTP2(server *http.Server) error {
+	cfg := s.cfg
+	h2s := &http2.Server{
+		MaxConcurrentStreams: uint32(cfg.GetHTTP2MaxConcurrentStreams()),
+		MaxReadFrameSize:     uint32(cfg.GetHTTP2MaxReadFrameSize()),
+		IdleTimeout:          cfg.GetHTTP2IdleTimeout(),
+	}
+	if cfg.GetH2C() {
+		server.Handler = h2c.NewHandler(server.Handler, h2s)
+	}
+
+	if server.TLSConfig == nil {
+		return nil
+	} else if !cfg.GetHTTP2() {
+		// non-nil empty map disables HTTP/2, see net/http.Server
+		server.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+		return nil
+	}
+	return http2.ConfigureServer(server, h2s)
+}
@@ -0,0 +1,132 @@
+/*
+ *  Copyright (c) 2022 NetEase Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+/*
+ * Project: Pigeon
+ * Created Date: 2026-10-18
+ */
+
+package http
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/opencurve/pigeon/pkg/log"
+	"github.com/quic-go/quic-go/http3"
+)
+
+type (
+	// http3Server serves HTTP/3 over QUIC on the UDP port of the listen
+	// address, it shares the gin engine with the TCP listener.
+	http3Server struct {
+		server  *http3.Server
+		conn    net.PacketConn
+		serving int32 // whether the QUIC listener is up, accessed atomically
+		stopped sync.Once
+	}
+)
+
+func (s *HTTPServer) initHTTP3() {
+	if !s.cfg.GetEnableHTTP3() {
+		return
+	}
+
+	s.h3 = &http3Server{
+		server: &http3.Server{
+			Addr:      s.cfg.GetListenAddress(),
+			Handler:   s.engine,
+			TLSConfig: s.tlsCfg.Clone(), // http2 amends the NextProtos of its own
+		},
+	}
+}
+
+// altSvc advertises the HTTP/3 endpoint to the clients of TCP listener,
+// only while the QUIC listener is actually serving.
+func (s *HTTPServer) altSvc(request *http.Request, header http.Header) {
+	if s.h3 != nil && atomic.LoadInt32(&s.h3.serving) == 1 &&
+		request.ProtoMajor < 3 {
+		s.h3.server.SetQUICHeaders(header)
+	}
+}
+
+// startHTTP3 starts the QUIC listener, like the upstream workers it
+// should be invoked after daemonization. The UDP port isn't shared with
+// the old process on reload, see Release.
+func (s *HTTPServer) startHTTP3() {
+	h3 := s.h3
+	if h3 == nil {
+		return
+	}
+
+	address := s.cfg.GetListenAddress()
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		s.Logger().Error("listen http3 failed",
+			log.Field("address", address),
+			log.Field("error", err))
+		return
+	}
+	h3.conn = conn
+	s.Logger().Info(fmt.Sprintf("ready to start http3 server %s: %s", s.Name(), address))
+	atomic.StoreInt32(&h3.serving, 1)
+	go func() {
+		err := h3.server.Serve(conn)
+		atomic.StoreInt32(&h3.serving, 0)
+		if err != http.ErrServerClosed {
+			s.Logger().Error("http3 server stopped",
+				log.Field("address", address),
+				log.Field("error", err))
+		}
+	}()
+}
+
+// stopHTTP3 sends GOAWAY to the clients, waits for the in-flight requests
+// up to timeout and then closes the QUIC listener.
+func (s *HTTPServer) stopHTTP3(timeout time.Duration) {
+	h3 := s.h3
+	if h3 == nil || h3.conn == nil {
+		return
+	}
+
+	h3.stopped.Do(func() {
+		atomic.StoreInt32(&h3.serving, 0)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err := h3.server.Shutdown(ctx); err != nil {
+			s.Logger().Warn("http3 server closed with in-flight requests",
+				log.Field("server", s.Name()),
+				log.Field("error", err))
+		}
+		h3.conn.Close()
+	})
+}
+
+// Release closes the QUIC listener at once before the new process starts
+// on reload. Unlike the TCP listeners, gracehttp can't hand the UDP socket
+// over, and sharing the port by SO_REUSEPORT doesn't work for QUIC: the
+// kernel rehashes the packets among the sockets, so packets of the old
+// process's connections may reach the new one. So the QUIC connections
+// are closed rather than drained, the clients fall back to TCP and then
+// learn the new process's QUIC listener by Alt-Svc.
+func (s *HTTPServer) Release() {
+	s.stopHTTP3(0)
+}
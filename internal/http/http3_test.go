@@ -0,0 +1,231 @@
+/*
+ *  Copyright (c) 2022 NetEase Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+/*
+ * Project: Pigeon
+ * Created Date: 2026-10-18
+ */
+
+package http
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencurve/pigeon/internal/configure"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// writeTestCert writes a self-signed certificate for 127.0.0.1 into dir.
+func writeTestCert(t *testing.T, dir string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	if err := os.WriteFile(path.Join(dir, "server.crt"), certPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path.Join(dir, "server.key"), keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newHTTP3TestServer initializes a server with HTTP/3 enabled on address
+// and serves the TCP listener ln, the returned function stops both.
+func newHTTP3TestServer(t *testing.T, address string, ln net.Listener) (*HTTPServer, func()) {
+	dir := t.TempDir()
+	writeTestCert(t, dir)
+	filename := path.Join(dir, "pigeon.yaml")
+	content := fmt.Sprintf(`
+servers:
+  - name: h3
+    listen: %s
+    enable_tls: true
+    enable_http3: true
+    tls_cert_file: %s
+    tls_key_file: %s
+`, address, path.Join(dir, "server.crt"), path.Join(dir, "server.key"))
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := configure.Parse(filename, configure.Context{Prefix: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewHTTPServer("h3")
+	s.Route("/", func(r *Request) bool {
+		return r.SendString("hello " + r.Protocol)
+	})
+	if err := s.Init(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	server := s.Server()
+	s.Start()
+	go server.ServeTLS(ln, "", "")
+	return s, func() {
+		server.Close()
+		s.Shutdown()
+	}
+}
+
+func listenTCP(t *testing.T) (net.Listener, string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ln, ln.Addr().String()
+}
+
+func tlsConfigFrom(t *testing.T, s *HTTPServer) *tls.Config {
+	cert, err := x509.ParseCertificate(s.tlsCfg.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &tls.Config{RootCAs: pool}
+}
+
+func get(t *testing.T, client *http.Client, url string) (*http.Response, string) {
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(body)
+}
+
+func TestHTTP3(t *testing.T) {
+	ln, address := listenTCP(t)
+	s, stop := newHTTP3TestServer(t, address, ln)
+	defer stop()
+
+	url := "https://" + address + "/"
+	tlsCfg := tlsConfigFrom(t, s)
+	_, port, _ := net.SplitHostPort(address)
+
+	// TCP listener advertises the QUIC one
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsCfg}}
+	resp, body := get(t, client, url)
+	if want := fmt.Sprintf(`h3=":%s"`, port); !strings.HasPrefix(resp.Header.Get("Alt-Svc"), want) {
+		t.Fatalf("Alt-Svc = %q, want prefix %q", resp.Header.Get("Alt-Svc"), want)
+	} else if body != "hello HTTP/1.1" {
+		t.Fatalf("body = %q", body)
+	}
+
+	h3 := &http3.Transport{TLSClientConfig: tlsCfg}
+	defer h3.Close()
+	resp, body = get(t, &http.Client{Transport: h3}, url)
+	if resp.ProtoMajor != 3 || body != "hello HTTP/3.0" {
+		t.Fatalf("proto = %s, body = %q", resp.Proto, body)
+	} else if len(resp.Header.Get("Alt-Svc")) != 0 {
+		t.Fatalf("Alt-Svc = %q over HTTP/3", resp.Header.Get("Alt-Svc"))
+	}
+}
+
+func TestHTTP3ListenFailed(t *testing.T) {
+	ln, address := listenTCP(t)
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	s, stop := newHTTP3TestServer(t, address, ln)
+	defer stop()
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfigFrom(t, s)}}
+	resp, _ := get(t, client, "https://"+address+"/")
+	if len(resp.Header.Get("Alt-Svc")) != 0 {
+		t.Fatalf("Alt-Svc = %q without QUIC listener", resp.Header.Get("Alt-Svc"))
+	}
+}
+
+// TestHTTP3Reload releases the QUIC listener of the old server before
+// the new one binds the UDP port, as the processes do on reload.
+func TestHTTP3Reload(t *testing.T) {
+	ln, address := listenTCP(t)
+	s, stop := newHTTP3TestServer(t, address, ln)
+	defer stop()
+
+	s.Release()
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfigFrom(t, s)}}
+	resp, _ := get(t, client, "https://"+address+"/")
+	if len(resp.Header.Get("Alt-Svc")) != 0 {
+		t.Fatalf("Alt-Svc = %q after released", resp.Header.Get("Alt-Svc"))
+	}
+
+	ln2, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2, stop2 := newHTTP3TestServer(t, address, ln2)
+	defer stop2()
+
+	h3 := &http3.Transport{TLSClientConfig: tlsConfigFrom(t, s2)}
+	defer h3.Close()
+	resp, _ = get(t, &http.Client{Transport: h3}, "https://"+address+"/")
+	if resp.ProtoMajor != 3 {
+		t.Fatalf("proto = %s", resp.Proto)
+	}
+
+	client = &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfigFrom(t, s2)}}
+	resp, _ = get(t, client, "https://"+ln2.Addr().String()+"/")
+	if len(resp.Header.Get("Alt-Svc")) == 0 {
+		t.Fatal("Alt-Svc is missing after reload")
+	}
+}
@@ -0,0 +1,119 @@
+/*
+ *  Copyright (c) 2022 NetEase Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+/*
+ * Project: Pigeon
+ * Created Date: 2026-10-18
+ */
+
+package http
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/opencurve/pigeon/pkg/log"
+)
+
+const (
+	// maximum mirror requests in flight per server, the exceeded ones are
+	// dropped, so a slow mirror can't exhaust the memory
+	MIRROR_MAX_PENDING = 1024
+)
+
+// mirrorBody keeps a copy of the request body for mirror.
+func (r *Request) mirrorBody(options *PorxyOptions) *replayBody {
+	reader, ok := options.Body.(io.Reader)
+	if len(options.Mirror) == 0 || !ok || reader == nil || reader == http.NoBody {
+		return nil
+	}
+	body := newReplayBody(reader, r.server.cfg.GetClientBodyBufferSize())
+	options.Body = body
+	return body
+}
+
+// mirror sends a copy of the request to the mirror in background after the
+// primary request is done, the response is discarded. It never blocks and
+// its failure is only logged.
+func (r *Request) mirror(options PorxyOptions, body *replayBody) {
+	logger := r.Logger()
+	address := options.Mirror
+	if len(upgradeType(options.header)) > 0 {
+		return
+	} else if body != nil {
+		data, ok := body.Bytes()
+		if !ok {
+			logger.Warn("request body is not kept, skip mirror",
+				log.Field("mirror", address))
+			return
+		}
+		options.Body = data
+	}
+
+	server := r.server
+	if atomic.AddInt64(&server.mirrors, 1) > MIRROR_MAX_PENDING {
+		atomic.AddInt64(&server.mirrors, -1)
+		logger.Warn("too many pending mirror requests, skip mirror",
+			log.Field("mirror", address))
+		return
+	}
+
+	upstream := server.Upstream(address)
+	key := ""
+	options.Address = address
+	if upstream != nil {
+		key = upstream.hashKey(r)
+		if len(upstream.cfg.GetScheme()) > 0 {
+			options.Scheme = upstream.cfg.GetScheme()
+		}
+	}
+	go func() {
+		defer atomic.AddInt64(&server.mirrors, -1)
+		err := mirrorDo(server, upstream, key, options)
+		if err != nil {
+			logger.Warn("mirror request failed",
+				log.Field("mirror", address),
+				log.Field("error", err))
+		}
+	}()
+}
+
+func mirrorDo(server *HTTPServer, upstream *Upstream, key string, options PorxyOptions) error {
+	var resp *http.Response
+	var err error
+	ctx := context.Background() // the mirror outlives the primary request
+	if upstream == nil {
+		resp, err = NewProxy(ctx, server.transport, options).Do()
+	} else {
+		peer, e := upstream.Get(key)
+		if e != nil {
+			return e
+		}
+		options.Address = peer.Address
+		resp, err = NewProxy(ctx, upstream.transport, options).Do()
+		failed, _ := newNextUpstream(options.NextUpstream).judge(resp, err)
+		upstream.Free(peer, resp, failed, 0)
+	}
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	_, err = io.Copy(io.Discard, resp.Body)
+	return err
+}
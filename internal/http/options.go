@@ -23,6 +23,7 @@
 package http
 
 import (
+	"net/http"
 	"time"
 )
 
@@ -35,10 +36,32 @@ type (
 		Method         string
 		Uri            string
 		Args           string
-		Headers        map[string]string
+		Headers        map[string]string // nil means all request headers
 		Body           interface{}
 		ConnectTimeout time.Duration
+		SendTimeout    time.Duration
 		ReadTimeout    time.Duration
+
+		NextUpstream      []string
+		NextUpstreamTries int
+		HedgeDelay        time.Duration // 0 means no hedging
+
+		Buffering     bool
+		FlushInterval time.Duration
+
+		ForwardedFor string
+		Forwarded    bool
+		Host         string
+
+		Mirror string // upstream name or literal address
+
+		// rewrite rules of response headers, see rewrite.go
+		Redirect     []string
+		CookieDomain []string
+		CookiePath   []string
+
+		header http.Header // multi-valued headers sent to upstream
+		origin bool        // Body is the client's, whose length is in header
 	}
 )
 
@@ -75,5 +98,110 @@ func (r *Request) WithHeaders(headers map[string]string) ProxyOption {
 func (r *Request) WithBody(body interface{}) ProxyOption {
 	return func(options *PorxyOptions) {
 		options.Body = body
+		options.origin = false
+	}
+}
+
+func (r *Request) WithConnectTimeout(timeout time.Duration) ProxyOption {
+	return func(options *PorxyOptions) {
+		options.ConnectTimeout = timeout
+	}
+}
+
+func (r *Request) WithSendTimeout(timeout time.Duration) ProxyOption {
+	return func(options *PorxyOptions) {
+		options.SendTimeout = timeout
+	}
+}
+
+func (r *Request) WithReadTimeout(timeout time.Duration) ProxyOption {
+	return func(options *PorxyOptions) {
+		options.ReadTimeout = timeout
+	}
+}
+
+func (r *Request) WithNextUpstream(conditions ...string) ProxyOption {
+	return func(options *PorxyOptions) {
+		options.NextUpstream = conditions
+	}
+}
+
+func (r *Request) WithNextUpstreamTries(tries int) ProxyOption {
+	return func(options *PorxyOptions) {
+		options.NextUpstreamTries = tries
+	}
+}
+
+// WithHedgeDelay sends a duplicate request to another upstream peer if
+// no response arrives within the delay, the first response wins. It only
+// applies to idempotent request without body, 0 disables hedging.
+func (r *Request) WithHedgeDelay(delay time.Duration) ProxyOption {
+	return func(options *PorxyOptions) {
+		options.HedgeDelay = delay
+	}
+}
+
+func (r *Request) WithBuffering(buffering bool) ProxyOption {
+	return func(options *PorxyOptions) {
+		options.Buffering = buffering
+	}
+}
+
+func (r *Request) WithFlushInterval(interval time.Duration) ProxyOption {
+	return func(options *PorxyOptions) {
+		options.FlushInterval = interval
+	}
+}
+
+func (r *Request) WithForwardedFor(mode string) ProxyOption {
+	return func(options *PorxyOptions) {
+		options.ForwardedFor = mode
+	}
+}
+
+func (r *Request) WithForwarded(forwarded bool) ProxyOption {
+	return func(options *PorxyOptions) {
+		options.Forwarded = forwarded
+	}
+}
+
+// WithHost sets the Host header sent to upstream, "$host" means
+// the client's Host header and empty means the upstream address.
+func (r *Request) WithHost(host string) ProxyOption {
+	return func(options *PorxyOptions) {
+		options.Host = host
+	}
+}
+
+// WithMirror sends a copy of the request to the mirror in background,
+// the mirror's response is discarded. The address is either an upstream
+// name or a literal address like ProxyPass.
+func (r *Request) WithMirror(address string) ProxyOption {
+	return func(options *PorxyOptions) {
+		options.Mirror = address
+	}
+}
+
+// WithRedirect sets the rewrite rules of Location and Refresh headers,
+// each rule is "default" or "<from> <to>".
+func (r *Request) WithRedirect(rules ...string) ProxyOption {
+	return func(options *PorxyOptions) {
+		options.Redirect = rules
+	}
+}
+
+// WithCookieDomain sets the rewrite rules ("<from> <to>")
+// of the domain attribute of Set-Cookie headers.
+func (r *Request) WithCookieDomain(rules ...string) ProxyOption {
+	return func(options *PorxyOptions) {
+		options.CookieDomain = rules
+	}
+}
+
+// WithCookiePath sets the rewrite rules ("<from> <to>")
+// of the path attribute of Set-Cookie headers.
+func (r *Request) WithCookiePath(rules ...string) ProxyOption {
+	return func(options *PorxyOptions) {
+		options.CookiePath = rules
 	}
 }
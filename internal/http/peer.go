@@ -0,0 +1,234 @@
+/*
+ *  Copyright (c) 2022 NetEase Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+/*
+ * Project: Pigeon
+ * Created Date: 2026-10-18
+ */
+
+package http
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/opencurve/pigeon/internal/configure"
+)
+
+const (
+	BREAKER_CLOSED = iota
+	BREAKER_OPEN
+	BREAKER_HALF_OPEN
+)
+
+const (
+	// decay time of response time's EWMA, see observe()
+	EWMA_DECAY = 10 * time.Second
+	// the least ratio of weight in slow start, see scale()
+	SLOW_START_MIN_RATIO = 0.01
+)
+
+type Peer struct {
+	Address     string
+	Weight      int
+	MaxFails    int
+	FailTimeout time.Duration
+	SlowStart   time.Duration
+	Backup      bool
+	Down        bool
+
+	route string // identifier in sticky cookie, see sticky.go
+
+	// smooth weighted round-robin, see nginx's ngx_http_upstream_round_robin.c
+	effectiveWeight int
+	currentWeight   float64 // in the unit of scaled weight, see scale()
+
+	// in-flight requests and peak EWMA of response time (in milliseconds),
+	// protected by upstream's mutex
+	conns    int
+	ewma     float64
+	observed time.Time
+
+	// active health check, see checker.go
+	unhealthy int32
+	rises     int
+	falls     int
+
+	// start time (unix nano) of slow start after recovery, see scale()
+	recovered int64
+
+	// passive health check (circuit breaker), protected by upstream's mutex
+	state   int
+	fails   int
+	checked time.Time // start of the current failure window
+	opened  time.Time
+}
+
+var breakerStates = map[int]string{
+	BREAKER_CLOSED:    "closed",
+	BREAKER_OPEN:      "open",
+	BREAKER_HALF_OPEN: "half-open",
+}
+
+func NewPeer(cfg configure.Peer) *Peer {
+	return &Peer{
+		Address:         cfg.Address,
+		Weight:          cfg.Weight,
+		MaxFails:        cfg.MaxFails,
+		FailTimeout:     cfg.FailTimeout,
+		SlowStart:       cfg.SlowStart,
+		Backup:          cfg.Backup,
+		Down:            cfg.Down,
+		route:           peerRoute(cfg.Address),
+		effectiveWeight: cfg.Weight,
+		state:           BREAKER_CLOSED,
+	}
+}
+
+func (p *Peer) isHealthy() bool {
+	return atomic.LoadInt32(&p.unhealthy) == 0
+}
+
+func (p *Peer) setHealthy(healthy bool) {
+	if healthy {
+		if atomic.CompareAndSwapInt32(&p.unhealthy, 1, 0) {
+			p.recover(time.Now())
+		}
+	} else {
+		atomic.StoreInt32(&p.unhealthy, 1)
+	}
+}
+
+// available reports whether the peer can be selected: an ejected peer
+// becomes available again once it has cooled down for fail_timeout,
+// and the peer in half-open state waits for its trial request.
+func (p *Peer) available(now time.Time) bool {
+	if p.Down || !p.isHealthy() {
+		return false
+	}
+
+	switch p.state {
+	case BREAKER_OPEN:
+		return now.Sub(p.opened) >= p.FailTimeout
+	case BREAKER_HALF_OPEN:
+		return false
+	}
+	return true
+}
+
+// acquire marks the peer as selected, the first request to an ejected
+// peer after cool-down is the trial request. It returns true if the
+// breaker state changed.
+func (p *Peer) acquire() bool {
+	if p.state == BREAKER_OPEN {
+		p.state = BREAKER_HALF_OPEN
+		return true
+	}
+	return false
+}
+
+// fail records a failure, the peer is ejected after max_fails failures
+// within fail_timeout or its trial request failed. It returns true if
+// the breaker state changed.
+func (p *Peer) fail(now time.Time) bool {
+	if p.MaxFails == 0 { // disabled
+		return false
+	}
+
+	switch p.state {
+	case BREAKER_HALF_OPEN:
+		p.state = BREAKER_OPEN
+		p.opened = now
+		return true
+	case BREAKER_CLOSED:
+		if now.Sub(p.checked) > p.FailTimeout {
+			p.fails = 0
+			p.checked = now
+		}
+		p.fails++
+		p.effectiveWeight -= p.Weight / p.MaxFails
+		if p.effectiveWeight < 0 {
+			p.effectiveWeight = 0
+		}
+		if p.fails >= p.MaxFails {
+			p.state = BREAKER_OPEN
+			p.opened = now
+			return true
+		}
+	}
+	return false
+}
+
+// succeed closes the breaker if the trial request succeeded.
+// It returns true if the breaker state changed.
+func (p *Peer) succeed(now time.Time) bool {
+	if p.state == BREAKER_HALF_OPEN {
+		p.state = BREAKER_CLOSED
+		p.fails = 0
+		p.recover(now)
+		return true
+	}
+	return false
+}
+
+// release gives the trial back if the request ended without a result
+// (e.g. canceled), so the next request to the peer becomes the trial.
+func (p *Peer) release() {
+	if p.state == BREAKER_HALF_OPEN {
+		p.state = BREAKER_OPEN // still cooled down, see available()
+	}
+}
+
+// recover starts the slow start of the peer which just recovered.
+func (p *Peer) recover(now time.Time) {
+	if p.SlowStart > 0 {
+		atomic.StoreInt64(&p.recovered, now.UnixNano())
+	}
+}
+
+// scale scales the weight seen by balancers, the weight of peer in slow
+// start ramps up linearly from (nearly) zero to the full within slow_start,
+// so its share of traffic grows gradually. The hash balancers ignore it
+// to keep the keys on their peers.
+func (p *Peer) scale(weight int, now time.Time) float64 {
+	recovered := atomic.LoadInt64(&p.recovered)
+	if recovered == 0 {
+		return float64(weight)
+	}
+
+	elapsed := now.Sub(time.Unix(0, recovered))
+	if elapsed >= p.SlowStart {
+		atomic.CompareAndSwapInt64(&p.recovered, recovered, 0)
+		return float64(weight)
+	}
+	ratio := math.Max(float64(elapsed)/float64(p.SlowStart), SLOW_START_MIN_RATIO)
+	return float64(weight) * ratio
+}
+
+// observe updates the peak EWMA of response time: it jumps to the peak
+// immediately and decays within EWMA_DECAY, so a peer slowing down is
+// avoided at once while a recovered one regains traffic gradually.
+func (p *Peer) observe(elapsed time.Duration, now time.Time) {
+	rtt := float64(elapsed) / float64(time.Millisecond)
+	if p.observed.IsZero() || rtt > p.ewma {
+		p.ewma = rtt
+	} else {
+		w := math.Exp(-float64(now.Sub(p.observed)) / float64(EWMA_DECAY))
+		p.ewma = p.ewma*w + rtt*(1-w)
+	}
+	p.observed = now
+}
@@ -0,0 +1,138 @@
+/*
+ *  Copyright (c) 2022 NetEase Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+/*
+ * Project: Pigeon
+ * Created Date: 2026-10-18
+ */
+
+package http
+
+import (
+	"crypto/tls"
+	"net"
+	"sync/atomic"
+)
+
+const (
+	CONN_IDLE = iota + 1
+	CONN_ACTIVE
+	CONN_CLOSED
+)
+
+type (
+	// PoolStats is the statistics of upstream connection pool.
+	PoolStats struct {
+		Idle   int64 // connections waiting for requests
+		Active int64 // connections serving requests
+		Dialed int64 // connections dialed in total
+		Reused int64 // requests served by reused connections in total
+	}
+
+	// pool tracks the connections of transport, the connections themselves
+	// are managed by http.Transport.
+	pool struct {
+		idle        int64
+		active      int64
+		dialed      int64
+		reused      int64
+		maxRequests int32 // keepalive_requests, 0 means unlimited
+	}
+
+	poolConn struct {
+		net.Conn
+		pool     *pool
+		state    int32
+		requests int32
+	}
+)
+
+func newPool(maxRequests int) *pool {
+	return &pool{maxRequests: int32(maxRequests)}
+}
+
+func (p *pool) counter(state int32) *int64 {
+	switch state {
+	case CONN_IDLE:
+		return &p.idle
+	case CONN_ACTIVE:
+		return &p.active
+	}
+	return nil
+}
+
+func (p *pool) wrap(conn net.Conn) net.Conn {
+	atomic.AddInt64(&p.dialed, 1)
+	atomic.AddInt64(&p.idle, 1)
+	return &poolConn{Conn: conn, pool: p, state: CONN_IDLE}
+}
+
+func (p *pool) stats() PoolStats {
+	return PoolStats{
+		Idle:   atomic.LoadInt64(&p.idle),
+		Active: atomic.LoadInt64(&p.active),
+		Dialed: atomic.LoadInt64(&p.dialed),
+		Reused: atomic.LoadInt64(&p.reused),
+	}
+}
+
+// findPoolConn returns the pool connection under the connection
+// got by request, which may be wrapped by TLS.
+func findPoolConn(conn net.Conn) *poolConn {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	c, _ := conn.(*poolConn)
+	return c
+}
+
+func (c *poolConn) transit(to int32) {
+	for {
+		from := atomic.LoadInt32(&c.state)
+		if from == CONN_CLOSED || from == to {
+			return
+		} else if atomic.CompareAndSwapInt32(&c.state, from, to) {
+			if counter := c.pool.counter(from); counter != nil {
+				atomic.AddInt64(counter, -1)
+			}
+			if counter := c.pool.counter(to); counter != nil {
+				atomic.AddInt64(counter, 1)
+			}
+			return
+		}
+	}
+}
+
+// acquire marks the connection serving a request, it returns false
+// if the connection reaches keepalive_requests and should be closed
+// after the request.
+func (c *poolConn) acquire(reused bool) bool {
+	c.transit(CONN_ACTIVE)
+	if reused {
+		atomic.AddInt64(&c.pool.reused, 1)
+	}
+	requests := atomic.AddInt32(&c.requests, 1)
+	return c.pool.maxRequests == 0 || requests < c.pool.maxRequests
+}
+
+func (c *poolConn) release() {
+	c.transit(CONN_IDLE)
+}
+
+func (c *poolConn) Close() error {
+	c.transit(CONN_CLOSED)
+	return c.Conn.Close()
+}
@@ -0,0 +1,98 @@
+/*
+ *  Copyright (c) 2022 NetEase Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+/*
+ * Project: Pigeon
+ * Created Date: 2026-10-18
+ */
+
+package http
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/opencurve/pigeon/internal/configure"
+)
+
+func TestPoolKeepaliveRequests(t *testing.T) {
+	var conns int32
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(w, r.Body)
+	}))
+	upstream.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	upstream.Start()
+	defer upstream.Close()
+
+	dir := t.TempDir()
+	filename := path.Join(dir, "pigeon.yaml")
+	content := `
+upstreams:
+  - name: backend
+    keepalive: 4
+    keepalive_requests: 2
+    servers:
+      - 127.0.0.1:9000
+`
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := configure.Parse(filename, configure.Context{Prefix: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport, err := newTransport(&configure.ServerConfigure{}, &cfg.GetUpstreams()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the request with body is copied by transport
+	for i := 0; i < 6; i++ {
+		resp, err := NewProxy(context.Background(), transport, PorxyOptions{
+			Method:  http.MethodPost,
+			Scheme:  "http",
+			Address: strings.TrimPrefix(upstream.URL, "http://"),
+			Uri:     "/",
+			Body:    "hello",
+		}).Do()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil || string(body) != "hello" {
+			t.Fatalf("body = %q, err = %v", body, err)
+		}
+	}
+
+	stats := transport.pool.stats()
+	if n := atomic.LoadInt32(&conns); n != 3 || stats.Dialed != 3 || stats.Reused != 3 {
+		t.Fatalf("connections = %d, dialed = %d, reused = %d, want 3 each",
+			n, stats.Dialed, stats.Reused)
+	}
+}
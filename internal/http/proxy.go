@@ -23,47 +23,253 @@
 package http
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
 
-	"github.com/imroc/req/v3"
+const (
+	PHASE_CONNECT = "connecting"
+	PHASE_SEND    = "sending request"
+	PHASE_READ    = "reading response"
 )
 
-var (
-	client *req.Client
+type (
+	Proxy struct {
+		ctx       context.Context
+		transport *transport
+		options   PorxyOptions
+	}
+
+	// proxyBody reads request body from the client, the send timeout
+	// is paused while reading and armed again for writing it to upstream.
+	proxyBody struct {
+		io.ReadCloser
+		watchdog *watchdog
+		timeout  timeouts
+		mutex    sync.Mutex
+		err      error
+	}
+
+	// responseBody arms the read timeout only while reading from upstream,
+	// the time spent on writing to the client doesn't count.
+	responseBody struct {
+		io.ReadCloser
+		watchdog *watchdog
+		timeout  timeouts
+	}
+
+	// clientError is the failure of reading request body from the client,
+	// which is not the upstream's fault.
+	clientError struct {
+		err error
+	}
 )
 
-func init() {
-	client = req.NewClient()
+func (e *clientError) Error() string { return "reading request body failed: " + e.err.Error() }
+func (e *clientError) Unwrap() error { return e.err }
+
+func NewProxy(ctx context.Context, transport *transport, options PorxyOptions) *Proxy {
+	return &Proxy{ctx: ctx, transport: transport, options: options}
 }
 
-type Proxy struct {
-	options PorxyOptions
+func (b *proxyBody) Read(p []byte) (int, error) {
+	b.watchdog.stop()
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		b.mutex.Lock()
+		b.err = err
+		b.mutex.Unlock()
+	}
+	b.watchdog.reset(b.timeout.send, PHASE_SEND)
+	return n, err
 }
 
-func NewProxy(options PorxyOptions) *Proxy {
-	return &Proxy{options: options}
+func (b *proxyBody) failed() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.err
+}
+
+func (b *responseBody) Read(p []byte) (int, error) {
+	b.watchdog.reset(b.timeout.read, PHASE_READ)
+	n, err := b.ReadCloser.Read(p)
+	b.watchdog.stop()
+	if err != nil && err != io.EOF && b.watchdog.timedOut() {
+		err = b.watchdog.err()
+	}
+	return n, err
+}
+
+func (b *responseBody) Close() error {
+	b.watchdog.stop()
+	defer b.watchdog.cancel()
+	return b.ReadCloser.Close()
 }
 
 func (p *Proxy) makeURL() string {
 	options := p.options
 	return (&url.URL{
 		Scheme:   options.Scheme,
-		Host:     options.Address,
+		Host:     urlHost(options.Address),
 		Path:     options.Uri,
 		RawQuery: options.Args,
 	}).String()
 }
 
+// makeBody converts the body option into reader and its length,
+// the length is -1 if it's unknown. The length of reader is only known
+// for in-memory readers and the client's body (maybe replayed).
+func (p *Proxy) makeBody(header http.Header) (io.Reader, int64, error) {
+	options := p.options
+	switch body := options.Body.(type) {
+	case nil:
+		return nil, 0, nil
+	case []byte:
+		return bytes.NewReader(body), int64(len(body)), nil
+	case string:
+		return strings.NewReader(body), int64(len(body)), nil
+	case io.Reader:
+		if body == http.NoBody {
+			return nil, 0, nil
+		}
+		return body, p.bodyLength(body, header), nil
+	default:
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, 0, err
+		}
+		return bytes.NewReader(data), int64(len(data)), nil
+	}
+}
+
+func (p *Proxy) bodyLength(body io.Reader, header http.Header) int64 {
+	switch reader := body.(type) {
+	case *bytes.Reader:
+		return int64(reader.Len())
+	case *strings.Reader:
+		return int64(reader.Len())
+	}
+	if !p.options.origin {
+		return -1
+	}
+	length, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	if err != nil {
+		return -1
+	}
+	return length
+}
+
+func (p *Proxy) makeHeader() http.Header {
+	if p.options.header != nil {
+		return p.options.header.Clone()
+	}
+	header := http.Header{}
+	for k, v := range p.options.Headers {
+		header.Set(k, v)
+	}
+	return header
+}
+
 func (p *Proxy) Do() (*http.Response, error) {
 	options := p.options
-	resp, err := client.R().
-		SetHeaders(options.Headers).
-		SetBody(options.Body).
-		Send(options.Method, p.makeURL())
+	timeout := p.transport.merge(options)
+	ctx, cancel := context.WithCancel(context.WithValue(p.ctx, timeoutKey{}, timeout))
+	watchdog := newWatchdog(cancel)
+	var conn *poolConn
+	var client *proxyBody
+	header := p.makeHeader()
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			watchdog.reset(timeout.send, PHASE_SEND)
+			conn = findPoolConn(info.Conn)
+			if conn != nil && !conn.acquire(info.Reused) && len(upgradeType(header)) == 0 {
+				// keepalive_requests reached, the request is copied by transport
+				// if it has body but the header is shared, so the upstream is asked
+				// to close the connection, which isn't reused after the response.
+				header.Set("Connection", "close")
+			}
+		},
+		PutIdleConn: func(err error) {
+			if err == nil && conn != nil {
+				conn.release()
+			}
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) { watchdog.reset(timeout.read, PHASE_READ) },
+	})
+
+	body, length, err := p.makeBody(header)
+	if err != nil {
+		cancel()
+		return nil, err
+	} else if body != nil && length == 0 {
+		readCloser(body).Close()
+		body = nil
+	} else if body != nil {
+		client = &proxyBody{
+			ReadCloser: readCloser(body),
+			watchdog:   watchdog,
+			timeout:    timeout,
+		}
+		body = client
+	}
+
+	request, err := http.NewRequestWithContext(ctx, options.Method, p.makeURL(), body)
 	if err != nil {
+		cancel()
+		if body != nil {
+			readCloser(body).Close()
+		}
+		return nil, err
+	}
+	request.ContentLength = length
+	request.Header = header
+	if len(options.Host) > 0 {
+		request.Host = options.Host
+	} else if isUnixSocket(options.Address) {
+		request.Host = UNIX_SOCKET_DEFAULT_HOST
+	}
+
+	resp, err := p.transport.roundTripper.RoundTrip(request)
+	if err != nil {
+		watchdog.stop()
+		cancel()
+		if watchdog.timedOut() {
+			return nil, watchdog.err()
+		} else if client != nil && client.failed() != nil {
+			return nil, &clientError{err: client.failed()}
+		}
 		return nil, err
 	}
 
-	return resp.Response, nil
+	// the connection is taken over by the tunnel, see upgrade.go
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		watchdog.stop()
+		if conn, ok := resp.Body.(io.ReadWriteCloser); ok {
+			resp.Body = &upgradeBody{ReadWriteCloser: conn, cancel: cancel}
+			return resp, nil
+		}
+	}
+
+	watchdog.stop() // armed again on reading body
+	resp.Body = &responseBody{
+		ReadCloser: resp.Body,
+		watchdog:   watchdog,
+		timeout:    timeout,
+	}
+	return resp, nil
+}
+
+func readCloser(reader io.Reader) io.ReadCloser {
+	if rc, ok := reader.(io.ReadCloser); ok {
+		return rc
+	}
+	return io.NopCloser(reader)
 }
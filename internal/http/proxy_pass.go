@@ -0,0 +1,267 @@
+/*
+ *  Copyright (c) 2022 NetEase Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+/*
+ * Project: Pigeon
+ * Created Date: 2026-10-18
+ */
+
+package http
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/opencurve/pigeon/pkg/log"
+)
+
+const (
+	NEXT_UPSTREAM_ERROR          = "error"
+	NEXT_UPSTREAM_TIMEOUT        = "timeout"
+	NEXT_UPSTREAM_NON_IDEMPOTENT = "non_idempotent"
+	NEXT_UPSTREAM_OFF            = "off"
+)
+
+var (
+	ErrBodyNotReplayable = errors.New("request body is too large to replay")
+
+	nonIdempotentMethods = map[string]bool{
+		http.MethodPost:  true,
+		http.MethodPatch: true,
+		"LOCK":           true,
+	}
+)
+
+type nextUpstream map[string]bool
+
+func newNextUpstream(conditions []string) nextUpstream {
+	next := nextUpstream{}
+	for _, condition := range conditions {
+		next[condition] = true
+	}
+	if next[NEXT_UPSTREAM_OFF] {
+		return nextUpstream{}
+	}
+	return next
+}
+
+func isTimeout(err error) bool {
+	var e net.Error
+	return errors.As(err, &e) && e.Timeout()
+}
+
+// judge tells whether the attempt is failed (for passive health check)
+// and whether it should be retried with the next upstream peer.
+func (next nextUpstream) judge(resp *http.Response, err error) (failed, retry bool) {
+	var e *clientError
+	if errors.As(err, &e) {
+		return false, false
+	} else if err != nil && isTimeout(err) {
+		return true, next[NEXT_UPSTREAM_TIMEOUT]
+	} else if err != nil {
+		return true, next[NEXT_UPSTREAM_ERROR]
+	}
+
+	switch resp.StatusCode {
+	case http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		failed = next["http_"+strconv.Itoa(resp.StatusCode)]
+		return failed, failed
+	}
+	return false, false
+}
+
+func (next nextUpstream) allow(method string) bool {
+	return len(next) > 0 &&
+		(!nonIdempotentMethods[method] || next[NEXT_UPSTREAM_NON_IDEMPOTENT])
+}
+
+func proxyStatus(resp *http.Response, err error) int {
+	var e *clientError
+	if errors.As(err, &e) && isTimeout(err) {
+		return http.StatusRequestTimeout
+	} else if errors.As(err, &e) {
+		return http.StatusBadRequest
+	} else if err != nil && isTimeout(err) {
+		return http.StatusGatewayTimeout
+	} else if err != nil {
+		return http.StatusBadGateway
+	}
+	return resp.StatusCode
+}
+
+func (r *Request) proxyUpstream(upstream *Upstream, options PorxyOptions) (*http.Response, error) {
+	next := newNextUpstream(options.NextUpstream)
+	tries := options.NextUpstreamTries
+	if tries <= 0 {
+		tries = len(upstream.Peers())
+	}
+	if !next.allow(options.Method) {
+		tries = 1
+	}
+
+	var body *replayBody
+	reader, ok := options.Body.(io.Reader)
+	if ok && reader != nil && reader != http.NoBody && tries > 1 {
+		body = newReplayBody(reader, r.server.cfg.GetClientBodyBufferSize())
+	}
+
+	var last *attempt
+	ctx := r.Context.Request.Context()
+	key := upstream.hashKey(r)
+	route := r.stickyRoute(upstream)
+	tried := []*Peer{}
+	upstream.budget.deposit()
+	for {
+		peer, err := upstream.get(route, key, tried)
+		if err != nil && last == nil {
+			return nil, err
+		} else if err != nil { // no more peers, return the last result
+			return last.resp, last.err
+		} else if last != nil {
+			last.close()
+		}
+
+		if body != nil {
+			options.Body, ok = body.Reader()
+			if !ok {
+				upstream.Release(peer)
+				return nil, ErrBodyNotReplayable
+			}
+		}
+		tried = append(tried, peer)
+		if hedgeable(options) {
+			last, tried = r.hedge(upstream, peer, key, tried, options, next)
+		} else {
+			last = &attempt{peer: peer}
+			last.send(ctx, upstream, options, next)
+			r.Var.addUpstream(peer.Address, proxyStatus(last.resp, last.err), last.score)
+		}
+
+		if !last.retry || len(tried) >= tries ||
+			(body != nil && !body.Replayable()) {
+			if !last.failed {
+				r.setSticky(upstream, route, last.resp, last.peer)
+			}
+			return last.resp, last.err
+		} else if !upstream.budget.withdraw() {
+			r.Logger().Warn("retry budget exhausted, stop trying next upstream",
+				log.Field("upstream", upstream.Name()))
+			return last.resp, last.err
+		}
+		r.Logger().Warn("proxy pass failed, try next upstream",
+			log.Field("upstream", upstream.Name()),
+			log.Field("peer", last.peer.Address),
+			log.Field("status", proxyStatus(last.resp, last.err)),
+			log.Field("error", last.err))
+	}
+}
+
+func (r *Request) ProxyPass(address string, opts ...ProxyOption) bool {
+	cfg := r.server.cfg
+	// address is either an upstream name or a literal host:port
+	upstream := r.server.Upstream(address)
+	scheme := r.Scheme
+	if upstream != nil && len(upstream.cfg.GetScheme()) > 0 {
+		scheme = upstream.cfg.GetScheme()
+	}
+	options := PorxyOptions{
+		Method:            r.Method,
+		Scheme:            scheme,
+		Address:           address,
+		Uri:               r.Uri,
+		Args:              r.RawArgs,
+		Body:              r.BodyReader,
+		origin:            true,
+		NextUpstream:      cfg.GetProxyNextUpstream(),
+		NextUpstreamTries: cfg.GetProxyNextUpstreamTries(),
+		Buffering:         cfg.GetProxyBuffering(),
+		FlushInterval:     cfg.GetFlushInterval(),
+		ForwardedFor:      cfg.GetProxyXForwardedFor(),
+		Forwarded:         cfg.GetProxyForwarded(),
+		Host:              cfg.GetProxySetHost(),
+		Redirect:          cfg.GetProxyRedirect(),
+		CookieDomain:      cfg.GetProxyCookieDomain(),
+		CookiePath:        cfg.GetProxyCookiePath(),
+	}
+	if upstream != nil {
+		options.Mirror = upstream.cfg.GetMirror()
+		options.HedgeDelay = upstream.cfg.GetHedgeDelay()
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	options.header = r.forwardHeaders(&options)
+	options.Host = r.proxyHost(options.Host)
+	body := r.mirrorBody(&options)
+
+	var resp *http.Response
+	var err error
+	if upstream != nil {
+		resp, err = r.proxyUpstream(upstream, options)
+	} else {
+		ctx := r.Context.Request.Context()
+		resp, err = NewProxy(ctx, r.server.transport, options).Do()
+		r.Var.addUpstream(address, proxyStatus(resp, err), "-")
+	}
+	if len(options.Mirror) > 0 {
+		r.mirror(options, body)
+	}
+	if err != nil {
+		r.Status = proxyStatus(nil, err)
+		r.Logger().Error("proxy pass failed",
+			log.Field("address", address),
+			log.Field("error", err))
+		return false
+	}
+
+	// handle response
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		timeout := options.ReadTimeout
+		if timeout == 0 {
+			timeout = cfg.GetProxyReadTimeout()
+		}
+		return r.proxyUpgrade(resp, upgradeType(options.header), timeout)
+	}
+
+	r.Status = resp.StatusCode
+	removeHopHeaders(resp.Header)
+	for k, v := range resp.Header {
+		r.headersOut.set(k, v)
+	}
+	r.rewriteHeaders(resp, &options)
+	if len(resp.Trailer) > 0 {
+		trailers := []string{}
+		for k := range resp.Trailer {
+			trailers = append(trailers, k)
+		}
+		r.headersOut.Set("Trailer", strings.Join(trailers, ", "))
+	}
+	r.content = &Stream{
+		reader:        resp.Body,
+		trailer:       resp.Trailer,
+		buffering:     options.Buffering,
+		flushInterval: options.FlushInterval,
+	}
+
+	return false
+}
@@ -0,0 +1,136 @@
+/*
+ *  Copyright (c) 2022 NetEase Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+/*
+ * Project: Pigeon
+ * Created Date: 2026-10-18
+ */
+
+package http
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencurve/pigeon/internal/configure"
+)
+
+const (
+	TEST_TIMEOUT = 100 * time.Millisecond
+	TEST_STALL   = 300 * time.Millisecond
+)
+
+// slowReader stalls before every read like a slow client.
+type slowReader struct {
+	chunks []string
+	err    error
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	time.Sleep(TEST_STALL)
+	if len(r.chunks) == 0 && r.err != nil {
+		return 0, r.err
+	} else if len(r.chunks) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.chunks[0])
+	r.chunks = r.chunks[1:]
+	return n, nil
+}
+
+func newTestProxy(t *testing.T, address string, body interface{}) *Proxy {
+	transport, err := newTransport(&configure.ServerConfigure{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewProxy(context.Background(), transport, PorxyOptions{
+		Method:      http.MethodPost,
+		Scheme:      "http",
+		Address:     address,
+		Uri:         "/",
+		Body:        body,
+		SendTimeout: TEST_TIMEOUT,
+		ReadTimeout: TEST_TIMEOUT,
+	})
+}
+
+func TestProxySlowClient(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		for i := 0; i < 3; i++ {
+			w.Write(body)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer upstream.Close()
+	address := strings.TrimPrefix(upstream.URL, "http://")
+
+	// stalls of the client on sending request body don't count
+	resp, err := newTestProxy(t, address, &slowReader{chunks: []string{"a", "b"}}).Do()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// nor on receiving response body
+	body := []byte{}
+	buffer := make([]byte, 2)
+	for {
+		n, err := resp.Body.Read(buffer)
+		body = append(body, buffer[:n]...)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(TEST_STALL)
+	}
+	if string(body) != "ababab" {
+		t.Fatalf("body = %q", body)
+	}
+}
+
+func TestProxyTimeout(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		time.Sleep(TEST_STALL)
+	}))
+	defer upstream.Close()
+	address := strings.TrimPrefix(upstream.URL, "http://")
+
+	_, err := newTestProxy(t, address, "hello").Do()
+	var e *timeoutError
+	if !errors.As(err, &e) || e.phase != PHASE_READ {
+		t.Fatalf("err = %v, want timed out while %s", err, PHASE_READ)
+	} else if failed, _ := newNextUpstream(nil).judge(nil, err); !failed {
+		t.Fatal("upstream timeout isn't judged as failed")
+	}
+
+	// the client's failure isn't the upstream's
+	reader := &slowReader{chunks: []string{"a"}, err: io.ErrUnexpectedEOF}
+	_, err = newTestProxy(t, address, reader).Do()
+	if failed, retry := newNextUpstream(nil).judge(nil, err); failed || retry {
+		t.Fatalf("err = %v, failed = %t, retry = %t", err, failed, retry)
+	} else if status := proxyStatus(nil, err); status != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", status, http.StatusBadRequest)
+	}
+}
@@ -47,16 +47,19 @@ type (
 		// request
 		Method     string
 		Scheme     string
+		Protocol   string // negotiated protocol, e.g. HTTP/1.1, HTTP/2.0
 		Host       string
 		Uri        string
 		RawArgs    string
 		Args       map[string]string
 		HeadersIn  map[string]string
 		BodyReader io.ReadCloser
+		headersIn  *Header
 
 		// response
 		Status      int
 		HeadersOut  map[string]string
+		headersOut  *Header
 		content     content
 		headersSent bool
 		bodySent    bool
@@ -68,10 +71,7 @@ func NewRequest(c *gin.Context, server *HTTPServer) *Request {
 	// request scheme
 	scheme := utils.Choose(request.TLS == nil, "http", "https")
 	// request headers
-	headers := map[string]string{}
-	for k := range request.Header {
-		headers[k] = c.GetHeader(k)
-	}
+	headersIn, headers := newHeader(request.Header.Clone())
 	// request arguments
 	args := map[string]string{}
 	values := request.URL.Query()
@@ -80,9 +80,11 @@ func NewRequest(c *gin.Context, server *HTTPServer) *Request {
 	}
 	// response headers
 	version := server.cfg.GetContext().Version
-	headersOut := map[string]string{
-		"Server": "pigeon/" + version,
+	header := http.Header{
+		"Server": []string{"pigeon/" + version},
 	}
+	server.altSvc(request, header)
+	headersOut, headersOutView := newHeader(header)
 
 	return &Request{
 		Context: c,
@@ -92,20 +94,33 @@ func NewRequest(c *gin.Context, server *HTTPServer) *Request {
 
 		Method:     request.Method,
 		Scheme:     scheme,
+		Protocol:   request.Proto,
 		Host:       request.URL.Host,
 		Uri:        request.URL.Path,
 		RawArgs:    request.URL.RawQuery,
 		Args:       args,
 		HeadersIn:  headers,
 		BodyReader: request.Body,
+		headersIn:  headersIn,
 
 		Status:      -1,
-		HeadersOut:  headersOut,
+		HeadersOut:  headersOutView,
+		headersOut:  headersOut,
 		headersSent: false,
 		bodySent:    false,
 	}
 }
 
+// HeaderIn returns all request headers, see Header.
+func (r *Request) HeaderIn() *Header {
+	return r.headersIn
+}
+
+// HeaderOut returns all response headers, see Header.
+func (r *Request) HeaderOut() *Header {
+	return r.headersOut
+}
+
 func (r *Request) GetConfig() *configure.ModuleConfig {
 	return r.server.cfg.GetConfig()
 }
@@ -143,44 +158,6 @@ func (r *Request) BindArgument(any interface{}) error {
 	return r.Context.ShouldBindQuery(any)
 }
 
-func (r *Request) ProxyPass(address string, opts ...ProxyOption) bool {
-	cfg := r.server.cfg
-	options := PorxyOptions{
-		Method:      r.Method,
-		Scheme:      r.Scheme,
-		Address:     address,
-		Uri:         r.Uri,
-		Args:        r.RawArgs,
-		Headers:     r.HeadersIn,
-		Body:        r.BodyReader,
-		ReadTimeout: cfg.GetProxyReadTimeout(),
-	}
-	for _, opt := range opts {
-		opt(&options)
-	}
-
-	proxy := NewProxy(options)
-	resp, err := proxy.Do()
-	if err != nil {
-		r.Status = http.StatusBadGateway
-		r.Logger().Error("proxy pass failed", log.Field("error", err))
-		return false
-	}
-
-	// handle response
-	r.Status = resp.StatusCode
-	for k, v := range resp.Header {
-		r.HeadersOut[k] = v[0]
-	}
-	r.content = &Reader{
-		reader: resp.Body,
-		size:   resp.ContentLength,
-		ctype:  r.HeadersOut["Content-Type"],
-	}
-
-	return false
-}
-
 func (r *Request) SendString(message string) bool {
 	r.content = &Message{message: message}
 	return false
@@ -232,7 +209,27 @@ func (r *Request) Logger() *zap.Logger {
 	return r.server.errorLogger
 }
 
+func (r *Request) bytesSent() int64 {
+	if r.Var.BytesSent > 0 {
+		return r.Var.BytesSent
+	} else if size := r.Context.Writer.Size(); size > 0 {
+		return int64(size)
+	}
+	return 0
+}
+
+// log writes the access log, the message keeps the original columns:
+//
+//	client_ip method request_uri protocol status request_time user_agent log_attach
+//
+// and the others are appended as labelled fields in a fixed order:
+//
+//	[upstream_addr=] [upstream_status=] [upstream_score=] [bytes_sent=] [bytes_received=]
 func (r *Request) log() {
+	if r.IsSubrequest() {
+		return
+	}
+
 	ctx := r.Context
 	format := []string{
 		ctx.ClientIP(),
@@ -244,7 +241,12 @@ func (r *Request) log() {
 		ctx.Request.UserAgent(),
 		r.Var.LogAttach,
 	}
-	r.server.accessLogger.Info(strings.Join(format, " "))
+	r.server.accessLogger.Info(strings.Join(format, " "),
+		log.Field("upstream_addr", r.Var.UpstreamAddr),
+		log.Field("upstream_status", r.Var.UpstreamStatus),
+		log.Field("upstream_score", r.Var.UpstreamScore),
+		log.Field("bytes_sent", r.bytesSent()),
+		log.Field("bytes_received", r.Var.BytesReceived))
 }
 
 func (r *Request) SendHeaders() {
@@ -260,8 +262,13 @@ func (r *Request) SendHeaders() {
 	ctx.Status(r.Status)
 
 	// response headers
-	for k, v := range r.HeadersOut {
-		ctx.Header(k, v)
+	header := ctx.Writer.Header()
+	for k, v := range r.headersOut.Clone() {
+		if len(v) == 1 && len(v[0]) == 0 {
+			header.Del(k) // same as gin.Context.Header
+		} else {
+			header[k] = v
+		}
 	}
 }
 
@@ -286,10 +293,15 @@ func (r *Request) SendBody() {
 		ctx.File(content.(*File).filename)
 	case *Reader:
 		reader := content.(*Reader)
+		if closer, ok := reader.reader.(io.Closer); ok {
+			defer closer.Close()
+		}
 		ctx.DataFromReader(r.Status, reader.size, reader.ctype, reader.reader, nil)
 	case *Buffer:
 		buffer := content.(*Buffer)
 		r.send(buffer)
+	case *Stream:
+		r.stream(content.(*Stream))
 	}
 }
 
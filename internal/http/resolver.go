@@ -0,0 +1,154 @@
+/*
+ *  Copyright (c) 2022 NetEase Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+/*
+ * Project: Pigeon
+ * Created Date: 2026-10-18
+ */
+
+package http
+
+import (
+	"context"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/opencurve/pigeon/internal/configure"
+	"github.com/opencurve/pigeon/pkg/log"
+	"go.uber.org/zap"
+)
+
+const (
+	RESOLVE_TIMEOUT = 5 * time.Second
+)
+
+// resolver re-resolves the hostname servers of upstream periodically,
+// the addresses appeared are added as peers with the same parameters
+// and the disappeared ones are removed.
+type resolver struct {
+	upstream *Upstream
+	cfg      *configure.UpstreamConfigure
+	logger   *zap.Logger
+	resolver *net.Resolver
+	stop     chan struct{}
+	once     sync.Once
+	wg       sync.WaitGroup
+}
+
+func newResolver(upstream *Upstream, logger *zap.Logger) *resolver {
+	cfg := upstream.cfg
+	r := &resolver{
+		upstream: upstream,
+		cfg:      cfg,
+		logger:   logger,
+		resolver: net.DefaultResolver,
+		stop:     make(chan struct{}),
+	}
+	if server := cfg.GetResolver(); len(server) > 0 {
+		r.resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, server)
+			},
+		}
+	}
+	return r
+}
+
+// splitHostname returns the hostname and port of the address,
+// it returns false if the address is an IP address or unix domain socket.
+func splitHostname(address string) (string, string, bool) {
+	if isUnixSocket(address) {
+		return "", "", false
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || net.ParseIP(host) != nil {
+		return "", "", false
+	}
+	return host, port, true
+}
+
+func (r *resolver) lookup(host, port string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), RESOLVE_TIMEOUT)
+	defer cancel()
+	ips, err := r.resolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	addresses := []string{}
+	for _, ip := range ips {
+		addresses = append(addresses, net.JoinHostPort(ip, port))
+	}
+	sort.Strings(addresses)
+	return addresses, nil
+}
+
+func (r *resolver) resolveAll() {
+	for i, pcfg := range r.cfg.GetPeers() {
+		host, port, ok := splitHostname(pcfg.Address)
+		if !ok {
+			continue
+		}
+
+		// keep the peers if the hostname can't be resolved temporarily
+		addresses, err := r.lookup(host, port)
+		if err != nil || len(addresses) == 0 {
+			r.logger.Warn("resolve upstream server failed",
+				log.Field("upstream", r.upstream.Name()),
+				log.Field("server", pcfg.Address),
+				log.Field("error", err))
+			continue
+		}
+
+		added, removed := r.upstream.setPeers(i, addresses)
+		if len(added) > 0 || len(removed) > 0 {
+			r.logger.Info("upstream server resolved",
+				log.Field("upstream", r.upstream.Name()),
+				log.Field("server", pcfg.Address),
+				log.Field("added", added),
+				log.Field("removed", removed))
+		}
+	}
+}
+
+func (r *resolver) run() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(r.cfg.GetResolveInterval())
+	defer ticker.Stop()
+
+	r.resolveAll()
+	for {
+		select {
+		case <-ticker.C:
+			r.resolveAll()
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+func (r *resolver) Start() {
+	r.wg.Add(1)
+	go r.run()
+}
+
+func (r *resolver) Stop() {
+	r.once.Do(func() { close(r.stop) })
+	r.wg.Wait()
+}
@@ -0,0 +1,220 @@
+/*
+ *  Copyright (c) 2022 NetEase Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+/*
+ * Project: Pigeon
+ * Created Date: 2026-10-18
+ */
+
+package http
+
+import (
+	"net"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opencurve/pigeon/internal/configure"
+	"go.uber.org/zap"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsServer is a DNS stand-in on localhost, which answers the A queries
+// with ips and the others with no records.
+type dnsServer struct {
+	conn  net.PacketConn
+	mutex sync.Mutex
+	ips   []string
+}
+
+func newDNSServer(t *testing.T) *dnsServer {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &dnsServer{conn: conn}
+	go s.serve()
+	t.Cleanup(func() { conn.Close() })
+	return s
+}
+
+func (s *dnsServer) setIPs(ips ...string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.ips = ips
+}
+
+func (s *dnsServer) serve() {
+	buffer := make([]byte, 512)
+	for {
+		n, addr, err := s.conn.ReadFrom(buffer)
+		if err != nil {
+			return
+		}
+		if reply, err := s.answer(buffer[:n]); err == nil {
+			s.conn.WriteTo(reply, addr)
+		}
+	}
+}
+
+func (s *dnsServer) answer(query []byte) ([]byte, error) {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(query)
+	if err != nil {
+		return nil, err
+	}
+	question, err := parser.Question()
+	if err != nil {
+		return nil, err
+	}
+
+	header.Response = true
+	header.Authoritative = true
+	builder := dnsmessage.NewBuilder(nil, header)
+	builder.EnableCompression()
+	if err := builder.StartQuestions(); err != nil {
+		return nil, err
+	} else if err := builder.Question(question); err != nil {
+		return nil, err
+	} else if err := builder.StartAnswers(); err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	ips := s.ips
+	s.mutex.Unlock()
+	for _, ip := range ips {
+		if question.Type != dnsmessage.TypeA {
+			break
+		}
+		a := dnsmessage.AResource{}
+		copy(a.A[:], net.ParseIP(ip).To4())
+		err := builder.AResource(dnsmessage.ResourceHeader{
+			Name:  question.Name,
+			Class: dnsmessage.ClassINET,
+			TTL:   1,
+		}, a)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return builder.Finish()
+}
+
+func newResolverTestUpstream(t *testing.T, dns string) *Upstream {
+	dir := t.TempDir()
+	filename := path.Join(dir, "pigeon.yaml")
+	content := `
+upstreams:
+  - name: backend
+    resolve: 1s
+    resolver: ` + dns + `
+    servers:
+      - backend.test:8080 weight=3 max_fails=2 fail_timeout=30s
+      - 127.0.0.1:9000
+`
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := configure.Parse(filename, configure.Context{Prefix: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewUpstream(&cfg.GetUpstreams()[0], nil, zap.NewNop())
+}
+
+// peers returns the peers of upstream by address.
+func peers(u *Upstream) map[string]*Peer {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	peers := map[string]*Peer{}
+	for _, peer := range u.primary {
+		peers[peer.Address] = peer
+	}
+	return peers
+}
+
+func addresses(peers map[string]*Peer) []string {
+	addresses := []string{}
+	for address := range peers {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+func TestResolverSetPeers(t *testing.T) {
+	dns := newDNSServer(t)
+	u := newResolverTestUpstream(t, dns.conn.LocalAddr().String())
+	if u.resolver == nil {
+		t.Fatal("resolver is not enabled")
+	}
+
+	// the hostname is resolved to peers with the server's parameters
+	dns.setIPs("127.0.0.2", "127.0.0.3")
+	u.resolver.resolveAll()
+	ps := peers(u)
+	want := []string{"127.0.0.1:9000", "127.0.0.2:8080", "127.0.0.3:8080"}
+	if got := addresses(ps); len(got) != len(want) ||
+		got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Fatalf("peers = %v, want %v", got, want)
+	}
+	for _, address := range want[1:] {
+		if peer := ps[address]; peer.Weight != 3 || peer.MaxFails != 2 {
+			t.Fatalf("peer %s: weight = %d, max_fails = %d", address, peer.Weight, peer.MaxFails)
+		}
+	}
+
+	// eject 127.0.0.2 by passive health check
+	kept := ps["127.0.0.2:8080"]
+	u.mutex.Lock()
+	for i := 0; i < kept.MaxFails; i++ {
+		kept.fail(time.Now())
+	}
+	u.mutex.Unlock()
+	if kept.state != BREAKER_OPEN {
+		t.Fatalf("breaker = %s, want open", breakerStates[kept.state])
+	}
+	weight := kept.effectiveWeight
+
+	// 127.0.0.3 disappears and 127.0.0.4 appears, 127.0.0.2 keeps its state
+	dns.setIPs("127.0.0.2", "127.0.0.4")
+	u.resolver.resolveAll()
+	ps = peers(u)
+	want = []string{"127.0.0.1:9000", "127.0.0.2:8080", "127.0.0.4:8080"}
+	if got := addresses(ps); len(got) != len(want) ||
+		got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Fatalf("peers = %v, want %v", got, want)
+	}
+	if ps["127.0.0.2:8080"] != kept || kept.state != BREAKER_OPEN ||
+		kept.effectiveWeight != weight {
+		t.Fatalf("peer 127.0.0.2:8080 lost its state")
+	}
+	if peer := ps["127.0.0.4:8080"]; peer.Weight != 3 || peer.state != BREAKER_CLOSED {
+		t.Fatalf("peer 127.0.0.4:8080: weight = %d, breaker = %s",
+			peer.Weight, breakerStates[peer.state])
+	}
+
+	// the peers are kept if the hostname resolves to nothing
+	dns.setIPs()
+	u.resolver.resolveAll()
+	if got := addresses(peers(u)); len(got) != len(want) {
+		t.Fatalf("peers = %v, want %v", got, want)
+	}
+}
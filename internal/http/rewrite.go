@@ -0,0 +1,129 @@
+/*
+ *  Copyright (c) 2022 NetEase Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+/*
+ * Project: Pigeon
+ * Created Date: 2026-10-18
+ */
+
+package http
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/opencurve/pigeon/internal/configure"
+)
+
+// rewriteRules parses the "<from> <to>" rules, the variables in <to>
+// are expanded, and the default rule of proxy_redirect is replaced
+// by the upstream's origin to client's origin.
+func (r *Request) rewriteRules(rules []string, resp *http.Response) [][2]string {
+	pairs := [][2]string{}
+	for _, rule := range rules {
+		items := strings.Fields(rule)
+		if rule == configure.PROXY_REDIRECT_DEFAULT && resp.Request != nil {
+			// the upstream may build the URL from either its address or Host header
+			request := resp.Request
+			origin := r.Scheme + "://" + r.Context.Request.Host + "/"
+			pairs = append(pairs, [2]string{request.URL.Scheme + "://" + request.URL.Host + "/", origin})
+			if request.Host != request.URL.Host && len(request.Host) > 0 {
+				pairs = append(pairs, [2]string{request.URL.Scheme + "://" + request.Host + "/", origin})
+			}
+		} else if len(items) == 2 {
+			pairs = append(pairs, [2]string{items[0], r.expandVariables(items[1])})
+		}
+	}
+	return pairs
+}
+
+// rewritePrefix replaces the prefix of value with the first matched rule.
+func rewritePrefix(value string, pairs [][2]string) string {
+	for _, pair := range pairs {
+		if strings.HasPrefix(value, pair[0]) {
+			return pair[1] + value[len(pair[0]):]
+		}
+	}
+	return value
+}
+
+// rewriteCookie rewrites the attribute (e.g. domain, path) of Set-Cookie
+// header with the first matched rule.
+func rewriteCookie(cookie, attribute string, pairs [][2]string, replace func(value, from, to string) (string, bool)) string {
+	parts := strings.Split(cookie, ";")
+	for i := 1; i < len(parts); i++ {
+		key, value, ok := strings.Cut(parts[i], "=")
+		if !ok || !strings.EqualFold(strings.TrimSpace(key), attribute) {
+			continue
+		}
+
+		for _, pair := range pairs {
+			if value, ok := replace(strings.TrimSpace(value), pair[0], pair[1]); ok {
+				parts[i] = key + "=" + value
+				break
+			}
+		}
+	}
+	return strings.Join(parts, ";")
+}
+
+// replaceDomain matches the domain regardless of the leading dot.
+func replaceDomain(value, from, to string) (string, bool) {
+	if strings.EqualFold(strings.TrimPrefix(value, "."), strings.TrimPrefix(from, ".")) {
+		return to, true
+	}
+	return value, false
+}
+
+func replacePath(value, from, to string) (string, bool) {
+	if strings.HasPrefix(value, from) {
+		return to + value[len(from):], true
+	}
+	return value, false
+}
+
+// rewriteHeaders rewrites the Location, Refresh and Set-Cookie headers of
+// upstream's response, so the internal address is not leaked to client.
+func (r *Request) rewriteHeaders(resp *http.Response, options *PorxyOptions) {
+	header := r.headersOut
+	redirects := r.rewriteRules(options.Redirect, resp)
+	if len(redirects) > 0 {
+		if location := header.Get("Location"); len(location) > 0 {
+			header.Set("Location", rewritePrefix(location, redirects))
+		}
+		// Refresh: 5; url=http://...
+		if refresh := header.Get("Refresh"); len(refresh) > 0 {
+			if i := strings.Index(strings.ToLower(refresh), "url="); i >= 0 {
+				i += len("url=")
+				header.Set("Refresh", refresh[:i]+rewritePrefix(refresh[i:], redirects))
+			}
+		}
+	}
+
+	domains := r.rewriteRules(options.CookieDomain, resp)
+	paths := r.rewriteRules(options.CookiePath, resp)
+	cookies := header.Values("Set-Cookie")
+	if len(cookies) == 0 || (len(domains) == 0 && len(paths) == 0) {
+		return
+	}
+	rewritten := []string{}
+	for _, cookie := range cookies {
+		cookie = rewriteCookie(cookie, "domain", domains, replaceDomain)
+		cookie = rewriteCookie(cookie, "path", paths, replacePath)
+		rewritten = append(rewritten, cookie)
+	}
+	header.set("Set-Cookie", rewritten)
+}
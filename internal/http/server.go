@@ -29,6 +29,7 @@ import (
 	"net/http/pprof"
 	"os"
 	"path"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/opencurve/pigeon/internal/configure"
@@ -47,6 +48,12 @@ type HTTPServer struct {
 	initer     []InitFunc
 	onShutdown []ShutdownFunc
 	enable     bool
+	upstreams  map[string]*Upstream
+	transport  *transport
+	mirrors    int64 // pending mirror requests
+	h3         *http3Server
+
+	closeTimeout time.Duration
 
 	errorLogger  *zap.Logger
 	accessLogger *zap.Logger
@@ -63,6 +70,7 @@ func NewHTTPServer(name ...string) *HTTPServer {
 		initer:     []InitFunc{},
 		onShutdown: []ShutdownFunc{},
 		enable:     true,
+		upstreams:  map[string]*Upstream{},
 	}
 }
 
@@ -127,7 +135,27 @@ func (s *HTTPServer) initTLS() error {
 	if err != nil {
 		return err
 	}
-	s.tlsCfg = &tls.Config{Certificates: []tls.Certificate{cert}}
+	certs, err := s.loadCertificates(&cert)
+	if err != nil {
+		return err
+	}
+	s.tlsCfg = &tls.Config{
+		Certificates:   []tls.Certificate{cert},
+		GetCertificate: certs.get,
+	}
+	return nil
+}
+
+func (s *HTTPServer) initUpstreams(cfg *configure.Configure) error {
+	upstreams := cfg.GetUpstreams()
+	for i := range upstreams {
+		transport, err := newTransport(s.cfg, &upstreams[i])
+		if err != nil {
+			return err
+		}
+		upstream := NewUpstream(&upstreams[i], transport, s.errorLogger)
+		s.upstreams[upstream.Name()] = upstream
+	}
 	return nil
 }
 
@@ -191,6 +219,16 @@ func (s *HTTPServer) Init(cfg *configure.Configure) error {
 	if err != nil {
 		return err
 	}
+	s.initHTTP3()
+	s.closeTimeout = cfg.GetCloseTimeout()
+	s.transport, err = newTransport(s.cfg, nil)
+	if err != nil {
+		return err
+	}
+	err = s.initUpstreams(cfg)
+	if err != nil {
+		return err
+	}
 
 	// add router to pprof
 	s.routePProf()
@@ -209,11 +247,22 @@ func (s *HTTPServer) Init(cfg *configure.Configure) error {
 func (s *HTTPServer) Server() *http.Server {
 	s.Logger().Info(fmt.Sprintf("ready to start server %s: %s",
 		s.Name(), s.cfg.GetListenAddress()))
-	return &http.Server{
+	server := &http.Server{
 		Addr:      s.cfg.GetListenAddress(),
 		Handler:   s.engine,
 		TLSConfig: s.tlsCfg,
 	}
+	err := s.configureHTTP2(server)
+	if err != nil {
+		s.Logger().Error("configure http2 failed",
+			log.Field("server", s.Name()),
+			log.Field("error", err))
+	}
+	return server
+}
+
+func (s *HTTPServer) Upstream(name string) *Upstream {
+	return s.upstreams[name]
 }
 
 func (s *HTTPServer) Route(relativePath string, handlers ...HandlerFunc) {
@@ -231,7 +280,20 @@ func (s *HTTPServer) DefaultRoute(handlers ...HandlerFunc) {
 	s.engine.NoRoute(router.wrapHandlers(handlers))
 }
 
+// Start starts the HTTP/3 listener and background workers (e.g. upstream
+// health checker), which is invoked in the daemon process before serving.
+func (s *HTTPServer) Start() {
+	s.startHTTP3()
+	for _, upstream := range s.upstreams {
+		upstream.Start()
+	}
+}
+
 func (s *HTTPServer) Shutdown() {
+	s.stopHTTP3(s.closeTimeout)
+	for _, upstream := range s.upstreams {
+		upstream.Stop()
+	}
 	for _, f := range s.onShutdown {
 		f()
 	}
@@ -0,0 +1,86 @@
+/*
+ *  Copyright (c) 2022 NetEase Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+/*
+ * Project: Pigeon
+ * Created Date: 2026-10-18
+ */
+
+package http
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/opencurve/pigeon/internal/configure"
+)
+
+// peerRoute is the identifier of peer in sticky cookie, which hides
+// the peer's address from clients.
+func peerRoute(address string) string {
+	digest := md5.Sum([]byte(address))
+	return hex.EncodeToString(digest[:])
+}
+
+// stick returns the available peer routed by the sticky cookie,
+// it must be invoked under the mutex.
+func (u *Upstream) stick(route string, now time.Time, tried []*Peer) *Peer {
+	for _, peers := range [][]*Peer{u.primary, u.backup} {
+		for _, peer := range peers {
+			if peer.route == route && peer.available(now) && !isTried(peer, tried) {
+				return peer
+			}
+		}
+	}
+	return nil
+}
+
+// stickyRoute returns the route carried by the request's sticky cookie.
+func (r *Request) stickyRoute(upstream *Upstream) string {
+	sticky := upstream.cfg.GetSticky()
+	if sticky == nil {
+		return ""
+	}
+	return r.GetVariable("cookie_" + sticky.Cookie)
+}
+
+func stickyCookie(sticky *configure.Sticky, peer *Peer) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     sticky.Cookie,
+		Value:    peer.route,
+		Domain:   sticky.Domain,
+		Path:     sticky.Path,
+		HttpOnly: sticky.HttpOnly,
+		Secure:   sticky.Secure,
+	}
+	if sticky.Expires > 0 {
+		cookie.Expires = time.Now().Add(sticky.Expires)
+		cookie.MaxAge = int(sticky.Expires / time.Second)
+	}
+	return cookie
+}
+
+// setSticky sets the sticky cookie on the response if the client
+// isn't routed to the peer which served it yet.
+func (r *Request) setSticky(upstream *Upstream, route string, resp *http.Response, peer *Peer) {
+	sticky := upstream.cfg.GetSticky()
+	if sticky == nil || resp == nil || peer.route == route {
+		return
+	}
+	resp.Header.Add("Set-Cookie", stickyCookie(sticky, peer).String())
+}
@@ -0,0 +1,141 @@
+/*
+ *  Copyright (c) 2022 NetEase Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+/*
+ * Project: Pigeon
+ * Created Date: 2026-10-18
+ */
+
+package http
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/opencurve/pigeon/pkg/log"
+)
+
+var (
+	bufferPool = sync.Pool{
+		New: func() interface{} {
+			buffer := make([]byte, 32*1024)
+			return &buffer
+		},
+	}
+)
+
+// flushWriter flushes the written data to client:
+//
+//	latency < 0: flush immediately after each write
+//	latency = 0: never flush, the data is flushed when buffer is full
+//	latency > 0: flush periodically
+type flushWriter struct {
+	mutex   sync.Mutex
+	writer  gin.ResponseWriter
+	latency time.Duration
+	timer   *time.Timer
+	pending bool
+	stopped bool
+}
+
+func (w *flushWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	n, err := w.writer.Write(p)
+	if err != nil || w.latency == 0 {
+		return n, err
+	} else if w.latency < 0 {
+		w.writer.Flush()
+		return n, nil
+	} else if w.pending {
+		return n, nil
+	}
+
+	if w.timer == nil {
+		w.timer = time.AfterFunc(w.latency, w.delayedFlush)
+	} else {
+		w.timer.Reset(w.latency)
+	}
+	w.pending = true
+	return n, nil
+}
+
+func (w *flushWriter) delayedFlush() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if !w.pending || w.stopped {
+		return
+	}
+	w.writer.Flush()
+	w.pending = false
+}
+
+func (w *flushWriter) stop() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.stopped = true
+	w.pending = false
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+}
+
+func (r *Request) flushLatency(stream *Stream) time.Duration {
+	ctype, _, _ := mime.ParseMediaType(r.Context.Writer.Header().Get("Content-Type"))
+	if ctype == "text/event-stream" || !stream.buffering {
+		return -1
+	}
+	return stream.flushInterval
+}
+
+// abort closes the client connection, so the client can tell
+// the truncated response from a complete one.
+func (r *Request) abort() {
+	conn, _, err := r.Context.Writer.Hijack()
+	if err == nil {
+		conn.Close()
+	}
+}
+
+func (r *Request) stream(stream *Stream) {
+	defer stream.reader.Close()
+	writer := &flushWriter{
+		writer:  r.Context.Writer,
+		latency: r.flushLatency(stream),
+	}
+	defer writer.stop()
+
+	buffer := bufferPool.Get().(*[]byte)
+	defer bufferPool.Put(buffer)
+	_, err := io.CopyBuffer(writer, stream.reader, *buffer)
+	if err != nil {
+		writer.stop()
+		r.Logger().Error("stream response body failed", log.Field("error", err))
+		r.abort()
+		return
+	}
+
+	// trailers are only available after the body is read
+	header := r.Context.Writer.Header()
+	for k, v := range stream.trailer {
+		header[http.CanonicalHeaderKey(k)] = v
+	}
+}
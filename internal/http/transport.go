@@ -0,0 +1,217 @@
+/*
+ *  Copyright (c) 2022 NetEase Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+/*
+ * Project: Pigeon
+ * Created Date: 2026-10-18
+ */
+
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/opencurve/pigeon/internal/configure"
+)
+
+type (
+	timeoutKey struct{}
+
+	timeouts struct {
+		connect time.Duration
+		send    time.Duration
+		read    time.Duration
+	}
+
+	// transport is the upstream transport shared by a server (for literal
+	// address) or an upstream group, it enforces the proxy timeouts:
+	//   connect: timeout for establishing a connection with upstream
+	//   send:    timeout between two successive write operations
+	//   read:    timeout between two successive read operations
+	transport struct {
+		roundTripper *http.Transport
+		timeouts     timeouts
+		pool         *pool
+	}
+
+	// watchdog cancels the request if there is no progress within timeout.
+	watchdog struct {
+		mutex  sync.Mutex
+		timer  *time.Timer
+		cancel context.CancelFunc
+		phase  string
+		fired  int32
+	}
+
+	timeoutError struct {
+		phase string
+	}
+)
+
+func (e *timeoutError) Error() string   { return "upstream timed out while " + e.phase }
+func (e *timeoutError) Timeout() bool   { return true }
+func (e *timeoutError) Temporary() bool { return true }
+
+// newTLSConfig creates the TLS config for connecting to upstream group's peers.
+func newTLSConfig(cfg *configure.UpstreamConfigure) (*tls.Config, error) {
+	tlsCfg := &tls.Config{
+		ServerName:         cfg.GetProxySSLServerName(), // empty means the host of peer
+		InsecureSkipVerify: !cfg.GetProxySSLVerify(),
+		MinVersion:         cfg.GetProxySSLMinVersion(),
+	}
+
+	if filename := cfg.GetProxySSLTrustedCA(); len(filename) > 0 {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.RootCAs = x509.NewCertPool()
+		if !tlsCfg.RootCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificate found in %s", filename)
+		}
+	}
+
+	if filename := cfg.GetProxySSLCertificate(); len(filename) > 0 {
+		cert, err := tls.LoadX509KeyPair(filename, cfg.GetProxySSLCertificateKey())
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	return tlsCfg, nil
+}
+
+// newTransport creates the transport for server, or for upstream group
+// if ucfg isn't nil, which has its own connection pool and TLS settings.
+func newTransport(cfg *configure.ServerConfigure, ucfg *configure.UpstreamConfigure) (*transport, error) {
+	t := &transport{
+		timeouts: timeouts{
+			connect: cfg.GetProxyConnectTimeout(),
+			send:    cfg.GetProxySendTimeout(),
+			read:    cfg.GetProxyReadTimeout(),
+		},
+		pool: newPool(0),
+	}
+	t.roundTripper = &http.Transport{
+		Proxy:                 nil,
+		DialContext:           t.dial,
+		DisableCompression:    true, // pass Accept-Encoding through
+		MaxIdleConnsPerHost:   http.DefaultMaxIdleConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   t.timeouts.connect,
+		ExpectContinueTimeout: time.Second,
+	}
+	if ucfg == nil {
+		return t, nil
+	}
+
+	// keepalive is the maximum idle connections of the whole group
+	// like nginx, the transport is dedicated to the group.
+	t.pool = newPool(ucfg.GetKeepaliveRequests())
+	t.roundTripper.DisableKeepAlives = ucfg.GetKeepalive() == 0
+	t.roundTripper.MaxIdleConns = ucfg.GetKeepalive()
+	t.roundTripper.MaxIdleConnsPerHost = ucfg.GetKeepalive()
+	t.roundTripper.IdleConnTimeout = ucfg.GetKeepaliveTimeout()
+	t.roundTripper.MaxConnsPerHost = ucfg.GetMaxConns()
+
+	tlsCfg, err := newTLSConfig(ucfg)
+	if err != nil {
+		return nil, fmt.Errorf("upstream %s: %v", ucfg.GetName(), err)
+	}
+	t.roundTripper.TLSClientConfig = tlsCfg
+	return t, nil
+}
+
+func (t *transport) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	timeout := t.timeouts.connect
+	if v, ok := ctx.Value(timeoutKey{}).(timeouts); ok && v.connect > 0 {
+		timeout = v.connect
+	}
+	dialer := &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}
+	network, address = dialAddress(network, address)
+	conn, err := dialer.DialContext(ctx, network, address)
+	if err != nil && isTimeout(err) {
+		return nil, &timeoutError{phase: PHASE_CONNECT}
+	} else if err != nil {
+		return nil, err
+	}
+	return t.pool.wrap(conn), nil
+}
+
+// merge returns the per-call timeouts, falls back to transport's.
+func (t *transport) merge(options PorxyOptions) timeouts {
+	merged := t.timeouts
+	if options.ConnectTimeout > 0 {
+		merged.connect = options.ConnectTimeout
+	}
+	if options.SendTimeout > 0 {
+		merged.send = options.SendTimeout
+	}
+	if options.ReadTimeout > 0 {
+		merged.read = options.ReadTimeout
+	}
+	return merged
+}
+
+func newWatchdog(cancel context.CancelFunc) *watchdog {
+	w := &watchdog{cancel: cancel}
+	w.timer = time.AfterFunc(time.Hour, func() {
+		w.mutex.Lock()
+		atomic.StoreInt32(&w.fired, 1)
+		w.mutex.Unlock()
+		w.cancel()
+	})
+	w.timer.Stop()
+	return w
+}
+
+// reset arms the timer for phase, the phase is frozen once the timer fired.
+func (w *watchdog) reset(timeout time.Duration, phase string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.timedOut() {
+		return
+	}
+	w.phase = phase
+	if timeout > 0 {
+		w.timer.Reset(timeout)
+	} else {
+		w.timer.Stop()
+	}
+}
+
+func (w *watchdog) err() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return &timeoutError{phase: w.phase}
+}
+
+func (w *watchdog) stop() {
+	w.timer.Stop()
+}
+
+func (w *watchdog) timedOut() bool {
+	return atomic.LoadInt32(&w.fired) == 1
+}
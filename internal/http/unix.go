@@ -0,0 +1,70 @@
+/*
+ *  Copyright (c) 2022 NetEase Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+/*
+ * Project: Pigeon
+ * Created Date: 2026-10-18
+ */
+
+package http
+
+import (
+	"encoding/hex"
+	"net"
+	"strings"
+
+	"github.com/opencurve/pigeon/internal/configure"
+)
+
+const (
+	// the unix domain socket path is hex encoded into URL's host with
+	// this suffix, because the host can't contain slash, and the connections
+	// to different sockets must not share the same key in connection pool.
+	UNIX_SOCKET_HOST_SUFFIX = ".unix.pigeon"
+	// Host header sent to unix domain socket peer by default
+	UNIX_SOCKET_DEFAULT_HOST = "localhost"
+)
+
+func isUnixSocket(address string) bool {
+	return strings.HasPrefix(address, configure.UNIX_SOCKET_PREFIX)
+}
+
+// urlHost returns the URL's host for peer address.
+func urlHost(address string) string {
+	if !isUnixSocket(address) {
+		return address
+	}
+	path := address[len(configure.UNIX_SOCKET_PREFIX):]
+	return hex.EncodeToString([]byte(path)) + UNIX_SOCKET_HOST_SUFFIX
+}
+
+// dialAddress returns the network and address to dial for the address
+// in URL's host or in peer address.
+func dialAddress(network, address string) (string, string) {
+	if isUnixSocket(address) {
+		return "unix", address[len(configure.UNIX_SOCKET_PREFIX):]
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil || !strings.HasSuffix(host, UNIX_SOCKET_HOST_SUFFIX) {
+		return network, address
+	}
+	path, err := hex.DecodeString(strings.TrimSuffix(host, UNIX_SOCKET_HOST_SUFFIX))
+	if err != nil {
+		return network, address
+	}
+	return "unix", string(path)
+}
@@ -0,0 +1,180 @@
+/*
+ *  Copyright (c) 2022 NetEase Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+/*
+ * Project: Pigeon
+ * Created Date: 2026-10-18
+ */
+
+package http
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/opencurve/pigeon/pkg/log"
+)
+
+type (
+	// upgradeBody is the upstream connection switched to other protocol
+	upgradeBody struct {
+		io.ReadWriteCloser
+		cancel context.CancelFunc
+	}
+
+	// tunnel splices client and upstream connection, both connections
+	// are closed if there is no data transferred within the timeout.
+	tunnel struct {
+		client   net.Conn
+		reader   *bufio.Reader // buffered data sent by client
+		upstream io.ReadWriteCloser
+		timeout  time.Duration
+		timer    *time.Timer
+		sent     int64
+		received int64
+	}
+)
+
+func (b *upgradeBody) Close() error {
+	defer b.cancel()
+	return b.ReadWriteCloser.Close()
+}
+
+func hasToken(value, token string) bool {
+	for _, item := range strings.Split(value, ",") {
+		if strings.EqualFold(strings.TrimSpace(item), token) {
+			return true
+		}
+	}
+	return false
+}
+
+// upgradeType returns the protocol (e.g. websocket) the client
+// requests to upgrade to, or empty string if it's not an upgrade request.
+func upgradeType(header http.Header) string {
+	if !hasToken(strings.Join(header.Values("Connection"), ","), "upgrade") {
+		return ""
+	}
+	return header.Get("Upgrade")
+}
+
+func (t *tunnel) pipe(dst io.Writer, src io.Reader, n *int64, done chan<- error) {
+	buffer := bufferPool.Get().(*[]byte)
+	defer bufferPool.Put(buffer)
+	for {
+		nr, err := src.Read(*buffer)
+		if nr > 0 {
+			t.timer.Reset(t.timeout)
+			nw, werr := dst.Write((*buffer)[:nr])
+			atomic.AddInt64(n, int64(nw))
+			if werr != nil {
+				done <- werr
+				return
+			}
+		}
+		if err != nil {
+			done <- err
+			return
+		}
+	}
+}
+
+func (t *tunnel) close() {
+	t.client.Close()
+	t.upstream.Close()
+}
+
+func (t *tunnel) run() error {
+	if t.timeout <= 0 {
+		t.timeout = time.Duration(1<<63 - 1)
+	}
+	t.timer = time.AfterFunc(t.timeout, t.close)
+	defer t.timer.Stop()
+
+	done := make(chan error, 2)
+	go t.pipe(t.upstream, t.reader, &t.received, done)
+	go t.pipe(t.client, t.upstream, &t.sent, done)
+	err := <-done
+	t.close()
+	<-done
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// proxyUpgrade hijacks the client connection and splices it with the
+// upgraded upstream connection until either side closes it.
+func (r *Request) proxyUpgrade(resp *http.Response, upgrade string, timeout time.Duration) bool {
+	upstream, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		resp.Body.Close()
+		r.Status = http.StatusBadGateway
+		r.Logger().Error("upstream connection is not writable")
+		return false
+	} else if !strings.EqualFold(resp.Header.Get("Upgrade"), upgrade) {
+		upstream.Close()
+		r.Status = http.StatusBadGateway
+		r.Logger().Error("upstream switched to unexpected protocol",
+			log.Field("request", upgrade),
+			log.Field("response", resp.Header.Get("Upgrade")))
+		return false
+	}
+
+	client, rw, err := r.Context.Writer.Hijack()
+	if err != nil {
+		upstream.Close()
+		r.Status = http.StatusInternalServerError
+		r.Logger().Error("hijack client connection failed", log.Field("error", err))
+		return false
+	}
+
+	// the response is written by ourselves instead of Finalize()
+	r.Status = resp.StatusCode
+	r.headersSent = true
+	r.bodySent = true
+	fmt.Fprintf(rw, "HTTP/1.1 %s\r\n", resp.Status)
+	resp.Header.Write(rw)
+	rw.WriteString("\r\n")
+	err = rw.Flush()
+	if err != nil {
+		client.Close()
+		upstream.Close()
+		return false
+	}
+
+	t := &tunnel{
+		client:   client,
+		reader:   rw.Reader,
+		upstream: upstream,
+		timeout:  timeout,
+	}
+	err = t.run()
+	r.Var.BytesSent = atomic.LoadInt64(&t.sent)
+	r.Var.BytesReceived = atomic.LoadInt64(&t.received)
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		r.Logger().Warn("tunnel closed", log.Field("error", err))
+	}
+	return false
+}
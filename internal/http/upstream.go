@@ -22,90 +22,307 @@
 
 package http
 
-
-/*
 import (
-	"net"
+	"errors"
+	"io"
+	"net/http"
 	"sync"
 	"time"
+
+	"github.com/opencurve/pigeon/internal/configure"
+	"github.com/opencurve/pigeon/pkg/log"
+	"go.uber.org/zap"
 )
 
-const (
-	STATUS_OK = iota
-	STATUS_ERROR
+var (
+	ErrNoLivePeer = errors.New("no live upstreams")
 )
 
-type Server struct {
-	sync.RWMutex    // lock status
-	Address         string
-	Weight          int
-	EffectiveWeight int
-	CurrentWeight   int
-	MaxFails        int `default:"3"`
-	FailTimeout     int
-	LastModify      time.Duration
-	Status          int `default:"0"`
+type (
+	Upstream struct {
+		name      string
+		cfg       *configure.UpstreamConfigure
+		mutex     sync.Mutex
+		groups    [][]*Peer // peers of each server, a hostname may be resolved to several peers
+		primary   []*Peer
+		backup    []*Peer
+		balancers []balancer   // for primary and backup peers
+		budget    *retryBudget // nil means unlimited
+		checker   *checker
+		resolver  *resolver
+		transport *transport
+		logger    *zap.Logger
+	}
+
+	// peerBody releases the peer's in-flight count once the response
+	// body is closed, the request is in flight while streaming.
+	peerBody struct {
+		io.ReadCloser
+		once sync.Once
+		done func()
+	}
+
+	// peerConn is the peerBody of upgraded connection, which is writable.
+	peerConn struct {
+		*peerBody
+		io.Writer
+	}
+)
+
+func (b *peerBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.done)
+	return err
+}
+
+func NewUpstream(cfg *configure.UpstreamConfigure, transport *transport, logger *zap.Logger) *Upstream {
+	u := &Upstream{
+		name:      cfg.GetName(),
+		cfg:       cfg,
+		groups:    [][]*Peer{},
+		transport: transport,
+		logger:    logger,
+	}
+	for _, pcfg := range cfg.GetPeers() {
+		u.groups = append(u.groups, []*Peer{NewPeer(pcfg)})
+	}
+	u.rebuild()
+	if cfg.GetRetryBudget() >= 0 {
+		u.budget = newRetryBudget(cfg.GetRetryBudget(),
+			cfg.GetRetryBudgetMin(), cfg.GetRetryBudgetWindow())
+	}
+	if cfg.GetCheckInterval() > 0 {
+		u.checker = newChecker(u, logger)
+	}
+	if cfg.GetResolveInterval() > 0 {
+		u.resolver = newResolver(u, logger)
+	}
+	return u
 }
 
-type Config struct {
-	CheckInterval time.Duration
-	CheckTimeout  time.Duration
+// rebuild rebuilds the peer lists and balancers after the peers changed,
+// it must be invoked under the mutex.
+func (u *Upstream) rebuild() {
+	u.primary = []*Peer{}
+	u.backup = []*Peer{}
+	for _, group := range u.groups {
+		for _, peer := range group {
+			if peer.Backup {
+				u.backup = append(u.backup, peer)
+			} else {
+				u.primary = append(u.primary, peer)
+			}
+		}
+	}
+	u.balancers = []balancer{
+		newBalancer(u.cfg.GetBalance(), u.primary),
+		newBalancer(u.cfg.GetBalance(), u.backup),
+	}
 }
 
-type Upstream struct {
-	servers []Server
-	cfg     *Config
+func (u *Upstream) Name() string {
+	return u.name
 }
 
-func NewUpstream() *Upstream {
-	return &Upstream{}
+func (u *Upstream) Peers() []*Peer {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	peers := append([]*Peer{}, u.primary...)
+	return append(peers, u.backup...)
 }
 
-func (u *Upstream) connect(s *Server, wg *sync.WaitGroup) {
-	defer wg.Done()
-	_, err := net.DialTimeout("tcp", s.Address, time.Duration(3)*time.Second)
-	if err == nil {
-		return
+func (u *Upstream) logBreaker(peer *Peer, state int) {
+	fields := []zap.Field{
+		log.Field("upstream", u.Name()),
+		log.Field("peer", peer.Address),
+		log.Field("state", breakerStates[state]),
 	}
+	if state == BREAKER_OPEN {
+		u.logger.Error("upstream peer ejected", fields...)
+	} else {
+		u.logger.Warn("upstream peer breaker changed", fields...)
+	}
+}
 
-	s.Lock()
-	defer s.Unlock()
-	s.Status = STATUS_ERROR
+// Get selects a peer except the tried ones, the key is used by hash based
+// balancer (see hashKey). The caller must invoke Free() after the request
+// to the peer is done.
+func (u *Upstream) Get(key string, tried ...*Peer) (*Peer, error) {
+	return u.get("", key, tried)
 }
 
-func (u *Upstream) checkHealth() {
-	var wg sync.WaitGroup
-	for _, server := range u.servers {
-		wg.Add(1)
-		go u.connect(&server, &wg)
+// get prefers the peer routed by sticky cookie if it's available.
+func (u *Upstream) get(route, key string, tried []*Peer) (*Peer, error) {
+	u.mutex.Lock()
+	now := time.Now()
+	var peer *Peer
+	if len(route) > 0 {
+		peer = u.stick(route, now, tried)
 	}
-	wg.Wait()
+	for i := 0; peer == nil && i < len(u.balancers); i++ {
+		peer = u.balancers[i].next(key, now, tried)
+	}
+	if peer == nil {
+		peer = u.fallback(tried)
+	}
+	changed := peer != nil && peer.acquire()
+	if peer != nil {
+		peer.conns++
+	}
+	u.mutex.Unlock()
+
+	if peer == nil {
+		return nil, ErrNoLivePeer
+	} else if changed {
+		u.logBreaker(peer, BREAKER_HALF_OPEN)
+	}
+	return peer, nil
 }
 
-func (u *Upstream) StartChecker() {
-	timer := time.NewTimer(u.cfg.CheckInterval)
-	defer timer.Stop()
+// fallback selects the peer ejected least recently if every peer is
+// ejected, which is the most likely one to have recovered, rather than
+// failing all the requests until some peer cools down.
+func (u *Upstream) fallback(tried []*Peer) *Peer {
+	var selected *Peer
+	for _, peers := range [][]*Peer{u.primary, u.backup} {
+		for _, peer := range peers {
+			if peer.Down || !peer.isHealthy() ||
+				peer.state == BREAKER_CLOSED || isTried(peer, tried) {
+				continue
+			} else if selected == nil || peer.opened.Before(selected.opened) {
+				selected = peer
+			}
+		}
+	}
+	return selected
+}
+
+// Stats returns the statistics of upstream's connection pool.
+func (u *Upstream) Stats() PoolStats {
+	return u.transport.pool.stats()
+}
+
+// Score returns the current score of the peer given by the balancer,
+// e.g. in-flight requests for least_conn, "-" if it's not scored.
+func (u *Upstream) Score(peer *Peer) string {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	if peer.Backup {
+		return u.balancers[1].score(peer)
+	}
+	return u.balancers[0].score(peer)
+}
 
-	for {
-		select {
-		case <-timer.C:
-			u.checkHealth()
-			timer.Reset(u.cfg.CheckInterval)
+// Free feeds the result of the request back for passive health check,
+// the response time (zero if unknown) of succeeded request is observed
+// for least_time balancer. The request stays in flight until the body
+// of resp (or the upgraded connection) is closed, see track().
+func (u *Upstream) Free(peer *Peer, resp *http.Response, failed bool, elapsed time.Duration) {
+	u.track(peer, resp)
+	u.mutex.Lock()
+	now := time.Now()
+	var changed bool
+	switch {
+	case failed && len(u.primary)+len(u.backup) == 1:
+		// the only peer is never ejected, there is no other one to take over
+	case failed:
+		changed = peer.fail(now)
+	default:
+		changed = peer.succeed(now)
+		if elapsed > 0 {
+			peer.observe(elapsed, now)
 		}
 	}
+	state := peer.state
+	u.mutex.Unlock()
+
+	if changed {
+		u.logBreaker(peer, state)
+	}
 }
 
-func (u *Upstream) isHealthy(s *Server) bool {
-	s.RLock()
-	defer s.RUnlock()
-	return s.Status == STATUS_OK
+// track decreases the peer's in-flight count once the response body is
+// closed, or at once if there is no response.
+func (u *Upstream) track(peer *Peer, resp *http.Response) {
+	done := func() {
+		u.mutex.Lock()
+		peer.conns--
+		u.mutex.Unlock()
+	}
+	if resp == nil {
+		done()
+		return
+	}
+
+	body := &peerBody{ReadCloser: resp.Body, done: done}
+	if conn, ok := resp.Body.(io.ReadWriteCloser); ok {
+		resp.Body = &peerConn{peerBody: body, Writer: conn}
+	} else {
+		resp.Body = body
+	}
 }
 
-func (u *Upstream) nextRoundRobinServer() (*Server, error) {
-	return nil, nil
+// Release releases the peer without result, e.g. the request was canceled
+// or not sent at all, which is neither the peer's failure nor success.
+func (u *Upstream) Release(peer *Peer) {
+	u.mutex.Lock()
+	peer.conns--
+	peer.release()
+	u.mutex.Unlock()
 }
 
-func (u *Upstream) Get() (*Server, error) {
-	return u.nextRoundRobinServer()
+// setPeers replaces the peers resolved from the index-th server with the
+// addresses, the peers still present are kept along with their state.
+// It returns the added and removed addresses.
+func (u *Upstream) setPeers(index int, addresses []string) (added, removed []string) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	pcfg := u.cfg.GetPeers()[index]
+	olds := map[string]*Peer{}
+	for _, peer := range u.groups[index] {
+		olds[peer.Address] = peer
+	}
+
+	group := []*Peer{}
+	for _, address := range addresses {
+		peer, ok := olds[address]
+		if ok {
+			delete(olds, address)
+		} else {
+			pcfg.Address = address
+			peer = NewPeer(pcfg)
+			added = append(added, address)
+		}
+		group = append(group, peer)
+	}
+	for address := range olds {
+		removed = append(removed, address)
+	}
+
+	if len(added) > 0 || len(removed) > 0 {
+		u.groups[index] = group
+		u.rebuild()
+	}
+	return added, removed
+}
+
+// Start starts the background health checker and resolver, it should be
+// invoked after daemonization, otherwise the goroutines would be lost
+// with the parent process.
+func (u *Upstream) Start() {
+	if u.checker != nil {
+		u.checker.Start()
+	}
+	if u.resolver != nil {
+		u.resolver.Start()
+	}
+}
+
+func (u *Upstream) Stop() {
+	if u.checker != nil {
+		u.checker.Stop()
+	}
+	if u.resolver != nil {
+		u.resolver.Stop()
+	}
 }
- */
@@ -0,0 +1,137 @@
+/*
+ *  Copyright (c) 2022 NetEase Inc.
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+/*
+ * Project: Pigeon
+ * Created Date: 2026-10-18
+ */
+
+package http
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencurve/pigeon/internal/configure"
+	"go.uber.org/zap"
+)
+
+// newTestUpstream creates the upstream group of servers.
+func newTestUpstream(t *testing.T, servers ...string) *Upstream {
+	dir := t.TempDir()
+	filename := path.Join(dir, "pigeon.yaml")
+	content := `
+upstreams:
+  - name: backend
+    servers:
+      - ` + strings.Join(servers, "\n      - ") + "\n"
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := configure.Parse(filename, configure.Context{Prefix: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewUpstream(&cfg.GetUpstreams()[0], nil, zap.NewNop())
+}
+
+// fail sends a failed request to the peer selected by upstream.
+func fail(t *testing.T, u *Upstream, tried ...*Peer) *Peer {
+	peer, err := u.Get("", tried...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Free(peer, nil, true, 0)
+	return peer
+}
+
+func TestUpstreamSinglePeer(t *testing.T) {
+	// max_fails=1 by default
+	u := newTestUpstream(t, "127.0.0.1:9000")
+	for i := 0; i < 3; i++ {
+		if peer := fail(t, u); peer.state != BREAKER_CLOSED {
+			t.Fatalf("the only peer is ejected after %d failures", i+1)
+		}
+	}
+}
+
+func TestUpstreamAllEjected(t *testing.T) {
+	u := newTestUpstream(t,
+		"127.0.0.1:9000 fail_timeout=30s",
+		"127.0.0.1:9001 fail_timeout=30s",
+		"127.0.0.1:9002 backup fail_timeout=30s")
+	first := fail(t, u)
+	second := fail(t, u)
+	backup := fail(t, u)
+	for _, peer := range []*Peer{first, second, backup} {
+		if peer.state != BREAKER_OPEN {
+			t.Fatalf("peer %s isn't ejected", peer.Address)
+		}
+	}
+
+	// the peer ejected least recently takes the request as its trial
+	peer, err := u.Get("")
+	if err != nil {
+		t.Fatal(err)
+	} else if peer != first || peer.state != BREAKER_HALF_OPEN {
+		t.Fatalf("peer = %s, breaker = %s, want %s in trial",
+			peer.Address, breakerStates[peer.state], first.Address)
+	}
+	u.Free(peer, nil, false, 0)
+	if first.state != BREAKER_CLOSED {
+		t.Fatalf("breaker = %s after the trial succeeded", breakerStates[first.state])
+	}
+
+	// the tried peers are still skipped
+	if peer, err := u.Get("", first); err != nil || peer != second {
+		t.Fatalf("peer = %v, err = %v, want %s", peer, err, second.Address)
+	}
+	if _, err := u.Get("", first, second, backup); err != ErrNoLivePeer {
+		t.Fatalf("err = %v, want %v", err, ErrNoLivePeer)
+	}
+}
+
+func TestUpstreamSlowStart(t *testing.T) {
+	u := newTestUpstream(t,
+		"127.0.0.1:9000",
+		"127.0.0.1:9001 slow_start=100s")
+	ps := peers(u)
+	cold := ps["127.0.0.1:9001"]
+	cold.recover(time.Now().Add(-25 * time.Second))
+
+	// a quarter of the weight, so a fifth of the requests
+	n := 0
+	for i := 0; i < 1000; i++ {
+		peer, err := u.Get("")
+		if err != nil {
+			t.Fatal(err)
+		} else if peer == cold {
+			n++
+		}
+		u.Free(peer, nil, false, 0)
+	}
+	if n < 180 || n > 220 {
+		t.Fatalf("%d of 1000 requests to the peer in slow start, want about 200", n)
+	}
+
+	cold.recover(time.Now().Add(-100 * time.Second))
+	if weight := cold.scale(cold.Weight, time.Now()); weight != float64(cold.Weight) {
+		t.Fatalf("weight = %f after slow start", weight)
+	}
+}
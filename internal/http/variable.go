@@ -23,6 +23,9 @@
 package http
 
 import (
+	"strconv"
+	"strings"
+
 	"github.com/gin-gonic/gin"
 	"github.com/opencurve/pigeon/internal/utils"
 )
@@ -34,6 +37,15 @@ type Variable struct {
 	Index      string
 	RequestURI string
 	LogAttach  string
+
+	// upstream peers attempted by ProxyPass, e.g. "127.0.0.1:9000, 127.0.0.1:9001"
+	UpstreamAddr   string
+	UpstreamStatus string
+	UpstreamScore  string // given by balancer, e.g. in-flight requests for least_conn
+
+	// bytes transferred by the tunnel of upgraded connection
+	BytesSent     int64
+	BytesReceived int64
 }
 
 func NewVariable(server *HTTPServer, ctx *gin.Context) *Variable {
@@ -45,5 +57,84 @@ func NewVariable(server *HTTPServer, ctx *gin.Context) *Variable {
 		RequestURI: ctx.Request.URL.RequestURI(),
 		Index:      cfg.GetIndex(),
 		LogAttach:  "-",
+
+		UpstreamAddr:   "-",
+		UpstreamStatus: "-",
+		UpstreamScore:  "-",
+	}
+}
+
+func (v *Variable) addUpstream(address string, status int, score string) {
+	if v.UpstreamAddr == "-" {
+		v.UpstreamAddr = address
+		v.UpstreamStatus = strconv.Itoa(status)
+		v.UpstreamScore = score
+		return
+	}
+	v.UpstreamAddr += ", " + address
+	v.UpstreamStatus += ", " + strconv.Itoa(status)
+	v.UpstreamScore += ", " + score
+}
+
+// GetVariable returns the value of nginx style variable (without '$'), e.g.
+// uri, request_uri, args, host, scheme, server_protocol, remote_addr,
+// arg_<name>, http_<name> and cookie_<name>, empty string if it's not found.
+func (r *Request) GetVariable(name string) string {
+	switch name {
+	case "uri":
+		return r.Uri
+	case "request_uri":
+		return r.Var.RequestURI
+	case "args":
+		return r.RawArgs
+	case "host":
+		return r.Context.Request.Host
+	case "scheme":
+		return r.Scheme
+	case "server_protocol":
+		return r.Protocol
+	case "request_method":
+		return r.Method
+	case "remote_addr":
+		return r.Var.RemoteAddr
+	}
+
+	switch {
+	case strings.HasPrefix(name, "arg_"):
+		return r.Args[name[len("arg_"):]]
+	case strings.HasPrefix(name, "http_"):
+		key := strings.ReplaceAll(name[len("http_"):], "_", "-")
+		return strings.Join(r.headersIn.Values(key), ", ")
+	case strings.HasPrefix(name, "cookie_"):
+		cookie, err := r.Context.Request.Cookie(name[len("cookie_"):])
+		if err == nil {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+func isVariableChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') ||
+		(c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// expandVariables replaces the variables in text, e.g. "$host$uri".
+func (r *Request) expandVariables(text string) string {
+	var sb strings.Builder
+	for i := 0; i < len(text); {
+		if text[i] != '$' {
+			sb.WriteByte(text[i])
+			i++
+			continue
+		}
+
+		j := i + 1
+		for j < len(text) && isVariableChar(text[j]) {
+			j++
+		}
+		sb.WriteString(r.GetVariable(text[i+1 : j]))
+		i = j
 	}
+	return sb.String()
 }